@@ -0,0 +1,230 @@
+package qrcode
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Pad codewords fill the data capacity behind the terminator, alternating
+// from padCodeword0.
+const (
+	padCodeword0 = 0xec
+	padCodeword1 = 0x11
+)
+
+// AuditKind tells what a span of the data bit stream holds.
+type AuditKind int
+
+const (
+	// AuditSegment is a character segment.
+	AuditSegment AuditKind = iota
+	// AuditHeader is an ECI, Structured Append or FNC1 header.
+	AuditHeader
+	// AuditTerminator is the 0000 terminator, shorter when the data capacity
+	// ends first.
+	AuditTerminator
+	// AuditBitPadding is the zero bits up to the next codeword boundary.
+	AuditBitPadding
+	// AuditPadCodeword is a pad codeword.
+	AuditPadCodeword
+	// AuditTrailing is data that is none of the above.
+	AuditTrailing
+)
+
+func (k AuditKind) String() string {
+	switch k {
+	case AuditSegment:
+		return "segment"
+	case AuditHeader:
+		return "header"
+	case AuditTerminator:
+		return "terminator"
+	case AuditBitPadding:
+		return "bit padding"
+	case AuditPadCodeword:
+		return "pad codeword"
+	case AuditTrailing:
+		return "trailing data"
+	}
+	return fmt.Sprintf("AuditKind(%d)", int(k))
+}
+
+// AuditSpan is a run of bits of the data codewords.
+type AuditSpan struct {
+	Kind AuditKind
+
+	// Start and End are the bit offsets of the span in the data codewords;
+	// End is excluded.
+	Start int
+	End   int
+
+	// Mode is the mode indicator of a segment or header.
+	Mode int
+
+	// Segment is the index in DataStream.Segments of a character segment, -1
+	// for every other kind.
+	Segment int
+}
+
+// AuditReport accounts for every bit of the data codewords of a symbol.
+type AuditReport struct {
+	Stream *DataStream
+
+	// Spans cover the data codewords from the first to the last bit, in
+	// order.
+	Spans []AuditSpan
+
+	// Remainder holds the remainder bits that follow the last codeword in
+	// the symbol. They are nil when only the data codewords were audited.
+	Remainder []bool
+
+	// Terminated is set when the segments are followed by a terminator or
+	// fill the data capacity exactly.
+	Terminated bool
+
+	// NonStandardPadding is set when the bit padding is not zero or the pad
+	// codewords do not alternate 0xEC and 0x11, for example zero codewords.
+	NonStandardPadding bool
+
+	// TrailingData is set when bits behind the segments are neither
+	// terminator nor padding: a codeword other than 0x00, 0xEC or 0x11 after
+	// the terminator, or a segment the stream cannot decode.
+	TrailingData bool
+
+	// CountMismatch is set when a segment declares more characters than the
+	// data holds.
+	CountMismatch bool
+
+	// RemainderSet is set when a remainder bit is not zero.
+	RemainderSet bool
+}
+
+// Clean reports whether the symbol holds nothing but its segments and
+// standard padding.
+func (r *AuditReport) Clean() bool {
+	return r.Terminated && !r.NonStandardPadding && !r.TrailingData && !r.CountMismatch && !r.RemainderSet
+}
+
+func (r *AuditReport) String() string {
+	var b strings.Builder
+	for _, span := range r.Spans {
+		fmt.Fprintf(&b, "%5d-%-5d %s", span.Start, span.End, span.Kind)
+		switch span.Kind {
+		case AuditSegment:
+			segment := r.Stream.Segments[span.Segment]
+			fmt.Fprintf(&b, " mode %d, %d characters", segment.Mode, segment.Count)
+		case AuditHeader:
+			fmt.Fprintf(&b, " mode %d", span.Mode)
+		}
+		b.WriteByte('\n')
+	}
+	fmt.Fprintf(&b, "%d remainder bits\n", len(r.Remainder))
+	for _, finding := range []struct {
+		set  bool
+		text string
+	}{
+		{!r.Terminated, "no terminator"},
+		{r.NonStandardPadding, "non-standard padding"},
+		{r.TrailingData, "trailing data"},
+		{r.CountMismatch, "character count exceeds the data"},
+		{r.RemainderSet, "remainder bits set"},
+	} {
+		if finding.set {
+			b.WriteString(finding.text + "\n")
+		}
+	}
+	return b.String()
+}
+
+// AuditDataStream decodes the data bit stream like ParseDataStream and
+// accounts for every bit of it: the segments and headers, the terminator,
+// the bit padding, the pad codewords and whatever else follows them.
+func AuditDataStream(dataCode []bool, version int) (*AuditReport, error) {
+	format, err := qrStreamFormat(version)
+	if err != nil {
+		return nil, err
+	}
+	return auditDataStream(dataCode, format)
+}
+
+func auditDataStream(dataCode []bool, format *streamFormat) (*AuditReport, error) {
+	stream, err := parseStream(dataCode, format, -1, nil)
+	if err != nil {
+		return nil, err
+	}
+	report := &AuditReport{
+		Stream:        stream,
+		Spans:         append([]AuditSpan{}, stream.spans...),
+		CountMismatch: stream.truncated,
+	}
+	pos := 0
+	if len(stream.spans) > 0 {
+		pos = stream.spans[len(stream.spans)-1].End
+	}
+	add := func(kind AuditKind, end int) {
+		report.Spans = append(report.Spans, AuditSpan{Kind: kind, Start: pos, End: end, Segment: -1})
+		pos = end
+	}
+	trailing := func() {
+		if pos < len(dataCode) {
+			add(AuditTrailing, len(dataCode))
+			report.TrailingData = true
+		}
+	}
+
+	// The terminator may be cut short by the end of the data capacity.
+	end := min(pos+format.terminatorBits, len(dataCode))
+	if pos == len(dataCode) || Bit2Int(dataCode[pos:end]) != 0 {
+		report.Terminated = pos == len(dataCode) && !stream.truncated
+		trailing()
+		return report, nil
+	}
+	report.Terminated = true
+	add(AuditTerminator, end)
+
+	if end = min((pos+7)/8*8, len(dataCode)); end > pos {
+		if Bit2Int(dataCode[pos:end]) != 0 {
+			report.NonStandardPadding = true
+		}
+		add(AuditBitPadding, end)
+	}
+
+	// Some encoders pad with zero codewords or do not alternate; that is
+	// non-standard, but only any other value is taken as hidden data.
+	for i := 0; pos+8 <= len(dataCode); i++ {
+		want := byte(padCodeword0)
+		if i%2 == 1 {
+			want = padCodeword1
+		}
+		codeword := Bit2Byte(dataCode[pos : pos+8])
+		if codeword != want {
+			if codeword != 0 && codeword != padCodeword0 && codeword != padCodeword1 {
+				break
+			}
+			report.NonStandardPadding = true
+		}
+		add(AuditPadCodeword, pos+8)
+	}
+	// The 4-bit last data codeword of Micro QR M1 and M3 is padded with
+	// zeros.
+	if len(dataCode)-pos == 4 && Bit2Int(dataCode[pos:]) == 0 {
+		add(AuditPadCodeword, len(dataCode))
+	}
+	trailing()
+	return report, nil
+}
+
+// auditSymbol audits the data codewords of a symbol and its remainder bits.
+func auditSymbol(dataCode, remainder []bool, format *streamFormat) (*AuditReport, error) {
+	report, err := auditDataStream(dataCode, format)
+	if err != nil {
+		return nil, err
+	}
+	report.Remainder = append([]bool{}, remainder...)
+	for _, bit := range remainder {
+		if bit {
+			report.RemainderSet = true
+		}
+	}
+	return report, nil
+}
@@ -17,28 +17,21 @@ func Byte2Bool(bl []byte) []bool {
 	return result
 }
 
+// Bits2Bytes decodes the data bit stream of a symbol to UTF-8, see
+// ParseDataStream.
 func Bits2Bytes(dataCode []bool, version int) ([]byte, error) {
-	// The first 4 bits are the encoding format, the next four bits are the actual data
-	mode := Bit2Int(dataCode[0:4])
-
-	encoder, err := GetDataEncoder(version)
-	if err != nil {
-		return nil, err
-	}
-
-	err = encoder.SetCharModeCharDecoder(mode)
+	stream, err := ParseDataStream(dataCode, version)
 	if err != nil {
 		return nil, err
 	}
-
-	modeCharDecoder := encoder.ModeCharDecoder
-
-	return modeCharDecoder.Decode(dataCode[4:])
+	return stream.Content, nil
 }
 
+// Bool2Byte packs bits into bytes, most significant bit first. Trailing bits
+// that do not fill a whole byte are dropped.
 func Bool2Byte(dataCode []bool) []byte {
 	var result []byte
-	for i := 0; i < len(dataCode); {
+	for i := 0; i+8 <= len(dataCode); {
 		result = append(result, Bit2Byte(dataCode[i:i+8]))
 		i += 8
 	}
@@ -65,3 +58,11 @@ func Bit2Byte(bits []bool) byte {
 	}
 	return byte(g)
 }
+
+// appendBits appends the width low bits of value, most significant bit first.
+func appendBits(bits []bool, value, width int) []bool {
+	for i := width - 1; i >= 0; i-- {
+		bits = append(bits, value>>i&1 == 1)
+	}
+	return bits
+}
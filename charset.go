@@ -0,0 +1,130 @@
+package qrcode
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// Character sets DetectCharset tells apart.
+const (
+	CharsetUTF8     = "UTF-8"
+	CharsetISO88591 = "ISO-8859-1"
+	CharsetShiftJIS = "Shift_JIS"
+	CharsetGB18030  = "GB18030"
+)
+
+var detectedCharsets = map[string]encoding.Encoding{
+	CharsetUTF8:     nil,
+	CharsetISO88591: charmap.ISO8859_1,
+	CharsetShiftJIS: japanese.ShiftJIS,
+	CharsetGB18030:  simplifiedchinese.GB18030,
+}
+
+// DetectCharset guesses the character set of byte data that comes without an
+// ECI. Valid UTF-8 is taken as UTF-8. Otherwise the data is checked against
+// Shift JIS and GB18030, and the one whose characters fall into the commonly
+// used ranges (kana and level 1 kanji, GB2312) wins. Data that looks like
+// neither is taken as ISO-8859-1, the default character set of QR codes.
+func DetectCharset(data []byte) string {
+	if utf8.Valid(data) {
+		return CharsetUTF8
+	}
+	sjis, sjisOK := shiftJISScore(data)
+	gb, gbOK := gb18030Score(data)
+	switch {
+	case sjisOK && (!gbOK || sjis >= gb):
+		return CharsetShiftJIS
+	case gbOK:
+		return CharsetGB18030
+	}
+	return CharsetISO88591
+}
+
+// CharsetToUTF8 transcodes data of a character set returned by DetectCharset
+// to UTF-8.
+func CharsetToUTF8(charset string, data []byte) ([]byte, error) {
+	enc, ok := detectedCharsets[charset]
+	if !ok {
+		return nil, fmt.Errorf("charset %s not supported", charset)
+	}
+	if enc == nil {
+		return data, nil
+	}
+	return enc.NewDecoder().Bytes(data)
+}
+
+// shiftJISScore counts the double byte characters of data in the Shift JIS
+// ranges of symbols, kana and level 1 kanji. It reports whether data is valid
+// Shift JIS with at least half of its non-ASCII characters in those ranges;
+// half-width katakana and level 2 kanji are rare in practice.
+func shiftJISScore(data []byte) (int, bool) {
+	common, total := 0, 0
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c < 0x80:
+			continue
+		case c >= 0xa1 && c <= 0xdf:
+			// Half-width katakana
+		case c >= 0x81 && c <= 0x9f || c >= 0xe0 && c <= 0xef:
+			if i+1 >= len(data) {
+				return 0, false
+			}
+			trail := data[i+1]
+			if trail < 0x40 || trail == 0x7f || trail > 0xfc {
+				return 0, false
+			}
+			if c <= 0x98 {
+				common++
+			}
+			i++
+		default:
+			return 0, false
+		}
+		total++
+	}
+	return common, 2*common >= total
+}
+
+// gb18030Score counts the double byte characters of data that are part of
+// GB2312. It reports whether data is valid GB18030 with at least half of its
+// non-ASCII characters in GB2312; the GBK and four byte extensions are rare in
+// practice.
+func gb18030Score(data []byte) (int, bool) {
+	common, total := 0, 0
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c < 0x80:
+			continue
+		case c >= 0x81 && c <= 0xfe:
+			if i+1 >= len(data) {
+				return 0, false
+			}
+			trail := data[i+1]
+			switch {
+			case trail >= 0x30 && trail <= 0x39:
+				if i+3 >= len(data) || data[i+2] < 0x81 || data[i+2] > 0xfe || data[i+3] < 0x30 || data[i+3] > 0x39 {
+					return 0, false
+				}
+				i += 3
+			case trail >= 0x40 && trail <= 0xfe && trail != 0x7f:
+				if c >= 0xa1 && c <= 0xf7 && trail >= 0xa1 {
+					common++
+				}
+				i++
+			default:
+				return 0, false
+			}
+		default:
+			return 0, false
+		}
+		total++
+	}
+	return common, 2*common >= total
+}
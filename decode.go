@@ -1,30 +1,181 @@
 package qrcode
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"image"
 	"io"
 )
 
 var Debug = false
 
+// DefaultErasureThreshold is the codeword confidence below which Decode and
+// the other package level functions erase a codeword.
+const DefaultErasureThreshold = 0.5
+
+// Decoder holds the settings of a decode. The zero value decodes like the
+// package level functions.
+type Decoder struct {
+	// ErasureThreshold is the codeword confidence below which a codeword is
+	// handed to Reed-Solomon decoding as an erasure instead of an unknown
+	// error. Zero means DefaultErasureThreshold; a negative threshold erases
+	// no codeword.
+	ErasureThreshold float64
+
+	// StrictAlphanumeric makes decoding fail on an alphanumeric segment whose
+	// character count runs past the end of the data, instead of decoding the
+	// characters that are complete.
+	StrictAlphanumeric bool
+}
+
+// erasureThreshold returns the erasure threshold d decodes with.
+func (d *Decoder) erasureThreshold() float64 {
+	if d.ErasureThreshold == 0 {
+		return DefaultErasureThreshold
+	}
+	return d.ErasureThreshold
+}
+
+// MaxImagePixels is the largest image, in pixels, Decode accepts. The image
+// header is checked before decoding so that forged dimensions cannot exhaust
+// memory.
+var MaxImagePixels = 1 << 24
+
 // QR code recognition function
 func Decode(fi io.Reader) (*Matrix, error) {
-	img, _, err := image.Decode(fi)
+	return new(Decoder).Decode(fi)
+}
+
+// Decode recognizes the QR code in an image like the package level Decode.
+func (d *Decoder) Decode(fi io.Reader) (*Matrix, error) {
+	img, err := readImage(fi)
 	if err != nil {
 		return nil, err
 	}
 
+	return d.DecodeImage(img)
+}
+
+// DecodeAll recognizes every QR code in an image, for example the symbols of
+// a Structured Append printed side by side.
+func DecodeAll(fi io.Reader) ([]*Matrix, error) {
+	return new(Decoder).DecodeAll(fi)
+}
+
+// DecodeAll recognizes every QR code in an image like the package level
+// DecodeAll.
+func (d *Decoder) DecodeAll(fi io.Reader) ([]*Matrix, error) {
+	img, err := readImage(fi)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.DecodeAllImage(img)
+}
+
+func readImage(fi io.Reader) (image.Image, error) {
+	buf, err := io.ReadAll(fi)
+	if err != nil {
+		return nil, err
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > MaxImagePixels {
+		return nil, fmt.Errorf("image of %dx%d pixels is too large", config.Width, config.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// DecodeImage recognizes the QR code in an already decoded image.
+func DecodeImage(img image.Image) (*Matrix, error) {
+	return new(Decoder).DecodeImage(img)
+}
+
+// DecodeImage recognizes the QR code in an already decoded image like the
+// package level DecodeImage.
+func (d *Decoder) DecodeImage(img image.Image) (*Matrix, error) {
 	qrMatrix, err := DecodeImg(img, ".", Debug)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := d.decodeMatrix(qrMatrix); err != nil {
+		return nil, err
+	}
+
+	return qrMatrix, nil
+}
+
+// DecodeAllImage recognizes every QR code in an already decoded image. The
+// symbols are returned from the most to the least regularly shaped one.
+func DecodeAllImage(img image.Image) ([]*Matrix, error) {
+	return new(Decoder).DecodeAllImage(img)
+}
+
+// DecodeAllImage recognizes every QR code in an already decoded image like the
+// package level DecodeAllImage.
+func (d *Decoder) DecodeAllImage(img image.Image) ([]*Matrix, error) {
+	matrix := &Matrix{
+		OrgImage: img,
+		OrgSize:  img.Bounds(),
+	}
+
+	matrix.ReadImage()
+
+	used := make(map[*PointGroup]bool)
+	var matrices []*Matrix
+	var lastErr error
+	for _, symbol := range GroupPositionDetectionPatterns(matrix.findPositionDetectionPatterns()) {
+		if used[symbol[0][0]] || used[symbol[1][0]] || used[symbol[2][0]] {
+			continue
+		}
+		qrMatrix := &Matrix{
+			OrgImage:  img,
+			OrgSize:   matrix.OrgSize,
+			OrgPoints: matrix.OrgPoints,
+		}
+		if _, err := qrMatrix.sample(symbol); err != nil {
+			lastErr = err
+			continue
+		}
+		if err := d.decodeMatrix(qrMatrix); err != nil {
+			lastErr = err
+			continue
+		}
+		for _, pattern := range symbol {
+			used[pattern[0]] = true
+		}
+		matrices = append(matrices, qrMatrix)
+	}
+
+	if len(matrices) == 0 {
+		if lastErr == nil {
+			lastErr = errors.New("lost Position Detection Pattern")
+		}
+		return nil, lastErr
+	}
+	return matrices, nil
+}
+
+// decodeMatrix decodes the sampled modules of qrMatrix and fills in the
+// decoded data.
+func (d *Decoder) decodeMatrix(qrMatrix *Matrix) error {
 	info, err := qrMatrix.FormatInfo()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	maskFunc := MaskFunc(info.Mask)
+	if info.MicroVersion > 0 {
+		maskFunc = MaskFunc(microMasks[info.Mask])
+	}
 	unmaskMatrix := new(Matrix)
 
 	for y, line := range qrMatrix.Points {
@@ -34,29 +185,80 @@ func Decode(fi io.Reader) (*Matrix, error) {
 		}
 		unmaskMatrix.Points = append(unmaskMatrix.Points, l)
 	}
+	unmaskMatrix.Confidence = qrMatrix.Confidence
 
 	dataArea := unmaskMatrix.DataArea()
 
-	dataCode, err := ParseBlock(qrMatrix, GetData(unmaskMatrix, dataArea))
+	data, confidence := GetData(unmaskMatrix, dataArea)
+
+	dataCode, stats, err := parseBlock(qrMatrix, data, confidence, d.erasureThreshold())
 	if err != nil {
-		return nil, err
+		return err
 	}
+	qrMatrix.ErrorCorrection = stats
+	qrMatrix.Data = dataCode
 
-	bt, err := Bits2Bytes(dataCode, unmaskMatrix.Version())
+	// The remainder bits follow the last codeword and are fewer than 8;
+	// Micro QR has none.
+	var format *streamFormat
+	remainder := data[len(data)/8*8:]
+	if info.MicroVersion > 0 {
+		format, err = microStreamFormat(info.MicroVersion)
+		remainder = nil
+	} else if info.RMQRVersion > 0 {
+		format, err = rmqrStreamFormat(info.RMQRVersion)
+	} else {
+		format, err = qrStreamFormat(unmaskMatrix.Version())
+	}
 	if err != nil {
-		return nil, err
+		return err
 	}
+	format.encoder.strictAlphanumeric = d.StrictAlphanumeric
+	audit, err := auditSymbol(dataCode, remainder, format)
+	if err != nil {
+		return err
+	}
+	qrMatrix.Audit = audit
+	stream := audit.Stream
 
-	qrMatrix.Content = string(bt)
+	qrMatrix.Content = string(stream.Content)
+	qrMatrix.Raw = stream.Raw
+	qrMatrix.ECI = stream.ECI
+	qrMatrix.StructuredAppend = stream.StructuredAppend
+	qrMatrix.FNC1 = stream.FNC1
+	qrMatrix.Charset = stream.Charset
+	qrMatrix.Segments = stream.Segments
 
-	return qrMatrix, nil
+	return nil
+}
+
+// ParseBlock splits the data modules into the interleaved blocks of the
+// symbol, corrects every block and returns the data codewords as bits along
+// with the error correction spent on each block. A block that needs the
+// error correction codewords kept back for misdecode protection is rejected,
+// as those only detect errors.
+// confidence is aligned with data; codewords holding a module below
+// DefaultErasureThreshold are erased in a block that does not decode without
+// them. A nil confidence treats every module as certain.
+func ParseBlock(m *Matrix, data []bool, confidence []float64) ([]bool, *ErrorCorrectionStats, error) {
+	return parseBlock(m, data, confidence, DefaultErasureThreshold)
 }
 
-func ParseBlock(m *Matrix, data []bool) ([]bool, error) {
+// parseBlock is ParseBlock with the erasure threshold of the decode.
+func parseBlock(m *Matrix, data []bool, confidence []float64, threshold float64) ([]bool, *ErrorCorrectionStats, error) {
+	if m.IsMicro() {
+		return parseMicroBlock(m, data, confidence, threshold)
+	}
+	if m.IsRMQR() {
+		return parseRMQRBlock(m, data, confidence, threshold)
+	}
+	if err := m.CheckSize(); err != nil {
+		return nil, nil, err
+	}
 	version := m.Version()
 	info, err := m.FormatInfo()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	var qrCodeVersion = QRcodeVersion{}
 	for _, qrCV := range Versions {
@@ -64,63 +266,103 @@ func ParseBlock(m *Matrix, data []bool) ([]bool, error) {
 			qrCodeVersion = qrCV
 		}
 	}
+	if qrCodeVersion.Version == 0 {
+		return nil, nil, fmt.Errorf("version %d not found", version)
+	}
+	return correctBlocks(&qrCodeVersion, fmt.Sprintf("version %d", version), data, confidence, MisdecodeProtection(version, qrCodeVersion.Level), threshold)
+}
+
+// correctBlocks deinterleaves and corrects the blocks of the data modules of
+// a symbol of qrCodeVersion like ParseBlock; name names the version in errors.
+func correctBlocks(qrCodeVersion *QRcodeVersion, name string, data []bool, confidence []float64, protection int, threshold float64) ([]bool, *ErrorCorrectionStats, error) {
+	numCodewords := 0
+	for _, block := range qrCodeVersion.Block {
+		numCodewords += block.NumBlocks * block.NumCodewords
+	}
+	if len(data) < numCodewords*8 {
+		return nil, nil, fmt.Errorf("got %d data bits, %s needs %d", len(data), name, numCodewords*8)
+	}
+
+	codewords := Bool2Byte(data[:len(data)/8*8])
+	weights := codewordWeights(len(codewords), confidence)
 
-	var dataBlocks [][]bool
+	var dataBlocks, errorBlocks [][]byte
+	var dataWeights, errorWeights [][]float64
 	for _, block := range qrCodeVersion.Block {
 		for i := 0; i < block.NumBlocks; i++ {
-			dataBlocks = append(dataBlocks, []bool{})
+			dataBlocks = append(dataBlocks, []byte{})
+			errorBlocks = append(errorBlocks, []byte{})
+			dataWeights = append(dataWeights, []float64{})
+			errorWeights = append(errorWeights, []float64{})
 		}
 	}
 
+	// Data codewords are interleaved first, then the error correction
+	// codewords; shorter blocks simply drop out of later rounds.
+	pos := 0
 	for {
-		leftLength := len(data)
+		leftLength := pos
 		no := 0
 		for _, block := range qrCodeVersion.Block {
 			for i := 0; i < block.NumBlocks; i++ {
-				if len(dataBlocks[no]) < block.NumDataCodewords*8 {
-					dataBlocks[no] = append(dataBlocks[no], data[0:8]...)
-					data = data[8:]
+				if len(dataBlocks[no]) < block.NumDataCodewords && pos < len(codewords) {
+					dataBlocks[no] = append(dataBlocks[no], codewords[pos])
+					dataWeights[no] = append(dataWeights[no], weights[pos])
+					pos++
 				}
 				no += 1
 			}
 		}
-		if leftLength == len(data) {
+		if leftLength == pos {
 			break
 		}
 	}
-
-	var errorBlocks [][]bool
-	for _, block := range qrCodeVersion.Block {
-		for i := 0; i < block.NumBlocks; i++ {
-			errorBlocks = append(errorBlocks, []bool{})
-		}
-	}
 	for {
-		leftLength := len(data)
+		leftLength := pos
 		no := 0
 		for _, block := range qrCodeVersion.Block {
 			for i := 0; i < block.NumBlocks; i++ {
-				if len(errorBlocks[no]) < (block.NumCodewords-block.NumDataCodewords)*8 {
-					errorBlocks[no] = append(errorBlocks[no], data[:8]...)
-					if len(data) > 8 {
-						data = data[8:]
-					}
+				if len(errorBlocks[no]) < block.NumCodewords-block.NumDataCodewords && pos < len(codewords) {
+					errorBlocks[no] = append(errorBlocks[no], codewords[pos])
+					errorWeights[no] = append(errorWeights[no], weights[pos])
+					pos++
 				}
 				no += 1
 			}
 		}
-		if leftLength == len(data) {
+		if leftLength == pos {
 			break
 		}
 	}
 
+	stats := new(ErrorCorrectionStats)
 	var result []byte
 	for i := range dataBlocks {
-		blockByte, err := QRReconstruct(Bool2Byte(dataBlocks[i]), Bool2Byte(errorBlocks[i]))
+		erasures := erasureCandidates(append(dataWeights[i], errorWeights[i]...), threshold)
+		corrected, err := QRReconstructErasures(dataBlocks[i], errorBlocks[i], erasures, protection)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+		if corrected.Erasures+2*corrected.Errors > len(errorBlocks[i])-protection {
+			return nil, nil, fmt.Errorf("%s cannot correct %d erasures and %d errors", name, corrected.Erasures, corrected.Errors)
+		}
+		stats.Blocks = append(stats.Blocks, NewBlockStats(len(dataBlocks[i]), len(errorBlocks[i]), protection, corrected.Erasures, corrected.Errors))
+		result = append(result, dataBlocks[i]...)
+	}
+	return Byte2Bool(result), stats, nil
+}
+
+// codewordWeights returns the confidence of each of n codewords, the lowest
+// confidence of its modules.
+func codewordWeights(n int, confidence []float64) []float64 {
+	weights := make([]float64, n)
+	for i := range weights {
+		weights[i] = 1
+		for j := i * 8; j < i*8+8 && j < len(confidence); j++ {
+			if confidence[j] < weights[i] {
+				weights[i] = confidence[j]
+			}
 		}
-		result = append(result, blockByte[:len(Bool2Byte(dataBlocks[i]))]...)
 	}
-	return Byte2Bool(result), nil
+	return weights
 }
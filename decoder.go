@@ -2,7 +2,9 @@ package qrcode
 
 import (
 	"image"
+	"math"
 	"path/filepath"
+	"sort"
 	"strconv"
 )
 
@@ -14,7 +16,35 @@ func DecodeImg(img image.Image, path string, debug bool) (*Matrix, error) {
 
 	matrix.ReadImage()
 
-	groups := matrix.SplitGroups()
+	positionDetectionPatterns := matrix.findPositionDetectionPatterns()
+
+	if debug {
+		for i, pattern := range positionDetectionPatterns {
+			ExportGroups(matrix.OrgSize, pattern, filepath.Join(path, "positionDetectionPattern"+strconv.Itoa(i)))
+		}
+	}
+
+	// A Micro QR symbol has a single finder pattern, an rMQR symbol one and
+	// a smaller sub-finder pattern in the opposite corner.
+	if len(positionDetectionPatterns) > 0 && len(positionDetectionPatterns) < 3 {
+		finder := positionDetectionPatterns[0]
+		for _, pattern := range positionDetectionPatterns[1:] {
+			if pattern[1].Max.X-pattern[1].Min.X > finder[1].Max.X-finder[1].Min.X {
+				finder = pattern
+			}
+		}
+		if _, err := matrix.sampleMicro(finder); err == nil {
+			return matrix, nil
+		}
+		return matrix.sampleRMQR(finder)
+	}
+	return matrix.sample(positionDetectionPatterns)
+}
+
+// findPositionDetectionPatterns pairs every solid group with the hollow group
+// around it.
+func (mx *Matrix) findPositionDetectionPatterns() [][]*PointGroup {
+	groups := mx.SplitGroups()
 	// Determine hollow
 	var hollow []*PointGroup
 	// Determine solid
@@ -42,13 +72,81 @@ func DecodeImg(img image.Image, path string, debug bool) (*Matrix, error) {
 			}
 		}
 	}
+	return positionDetectionPatterns
+}
 
-	if debug {
-		for i, pattern := range positionDetectionPatterns {
-			ExportGroups(matrix.OrgSize, pattern, filepath.Join(path, "positionDetectionPattern"+strconv.Itoa(i)))
+// GroupPositionDetectionPatterns groups position detection patterns into
+// triples that may form a symbol: three patterns of about the same size whose
+// centers form a right isosceles triangle at least one version 1 symbol wide.
+// The triples are ordered from the most to the least regular one and may
+// share patterns.
+func GroupPositionDetectionPatterns(positionDetectionPatterns [][]*PointGroup) [][][]*PointGroup {
+	type candidate struct {
+		symbol [][]*PointGroup
+		score  float64
+	}
+
+	groups := make([]*PointGroup, len(positionDetectionPatterns))
+	sizes := make([]float64, len(positionDetectionPatterns))
+	for i, pattern := range positionDetectionPatterns {
+		groups[i] = PossListToGroup(pattern)
+		sizes[i] = float64(groups[i].Max.X-groups[i].Min.X+groups[i].Max.Y-groups[i].Min.Y+2) / 2
+	}
+
+	var candidates []candidate
+	for i := range groups {
+		for j := i + 1; j < len(groups); j++ {
+			for k := j + 1; k < len(groups); k++ {
+				minSize := math.Min(sizes[i], math.Min(sizes[j], sizes[k]))
+				maxSize := math.Max(sizes[i], math.Max(sizes[j], sizes[k]))
+				sizeOffset := (maxSize - minSize) / maxSize
+				if sizeOffset > 0.3 {
+					continue
+				}
+				// A finder pattern is 7 modules wide and the centers of
+				// two finder patterns are at least 14 modules apart.
+				module := (sizes[i] + sizes[j] + sizes[k]) / 21
+
+				best := math.Inf(1)
+				for _, corner := range [][3]int{{i, j, k}, {j, i, k}, {k, i, j}} {
+					a, b, c := groups[corner[0]].Center, groups[corner[1]].Center, groups[corner[2]].Center
+					abX, abY := float64(b.X-a.X), float64(b.Y-a.Y)
+					acX, acY := float64(c.X-a.X), float64(c.Y-a.Y)
+					ab, ac := math.Hypot(abX, abY), math.Hypot(acX, acY)
+					if ab == 0 || ac == 0 || math.Min(ab, ac) < 13*module {
+						continue
+					}
+					lengthOffset := math.Abs(ab-ac) / math.Max(ab, ac)
+					cos := math.Abs(abX*acX+abY*acY) / (ab * ac)
+					if lengthOffset > 0.15 || cos > 0.15 {
+						continue
+					}
+					best = math.Min(best, lengthOffset+cos)
+				}
+				if math.IsInf(best, 1) {
+					continue
+				}
+				candidates = append(candidates, candidate{
+					symbol: [][]*PointGroup{positionDetectionPatterns[i], positionDetectionPatterns[j], positionDetectionPatterns[k]},
+					score:  best + sizeOffset,
+				})
+			}
 		}
 	}
 
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score < candidates[j].score
+	})
+	symbols := make([][][]*PointGroup, len(candidates))
+	for i, c := range candidates {
+		symbols[i] = c.symbol
+	}
+	return symbols
+}
+
+// sample reads the module grid of the symbol located by
+// positionDetectionPatterns into Points and Confidence.
+func (mx *Matrix) sample(positionDetectionPatterns [][]*PointGroup) (*Matrix, error) {
 	lineWidth := LineWidth(positionDetectionPatterns)
 
 	pdp, err := NewPositionDetectionPattern(positionDetectionPatterns)
@@ -60,17 +158,17 @@ func DecodeImg(img image.Image, path string, debug bool) (*Matrix, error) {
 	topStart := &Point{X: pdp.TopLeft.Center.X + (int(3.5*lineWidth) + 1), Y: pdp.TopLeft.Center.Y + int(3*lineWidth)}
 	topEnd := &Point{X: pdp.Right.Center.X - (int(3.5*lineWidth) + 1), Y: pdp.Right.Center.Y + int(3*lineWidth)}
 
-	topTimePattens := Line(topStart, topEnd, matrix)
+	topTimePattens := Line(topStart, topEnd, mx)
 
-	topCL := matrix.CenterList(topTimePattens, topStart.X)
+	topCL := mx.CenterList(topTimePattens, topStart.X)
 
 	// Left marking line
 	leftStart := &Point{X: pdp.TopLeft.Center.X + int(3*lineWidth), Y: pdp.TopLeft.Center.Y + (int(3.5*lineWidth) + 1)}
 	leftEnd := &Point{X: pdp.Bottom.Center.X + int(3*lineWidth), Y: pdp.Bottom.Center.Y - (int(3.5*lineWidth) + 1)}
 
-	leftTimePattens := Line(leftStart, leftEnd, matrix)
+	leftTimePattens := Line(leftStart, leftEnd, mx)
 
-	leftCL := matrix.CenterList(leftTimePattens, leftStart.Y)
+	leftCL := mx.CenterList(leftTimePattens, leftStart.Y)
 
 	var qrTopCL []int
 	for i := -3; i <= 3; i++ {
@@ -92,15 +190,25 @@ func DecodeImg(img image.Image, path string, debug bool) (*Matrix, error) {
 		qrLeftCL = append(qrLeftCL, pdp.Bottom.Center.Y+int(float64(i)*lineWidth))
 	}
 
+	// Sample the inner half of every module to judge how certain its value is.
+	radius := int(lineWidth / 4)
+
 	for _, y := range qrLeftCL {
 		var line []bool
+		var confidence []float64
 		for _, x := range qrTopCL {
-			line = append(line, matrix.AtOrgPoints(x, y))
+			line = append(line, mx.AtOrgPoints(x, y))
+			confidence = append(confidence, mx.SampleConfidence(x, y, radius))
 		}
-		matrix.Points = append(matrix.Points, line)
+		mx.Points = append(mx.Points, line)
+		mx.Confidence = append(mx.Confidence, confidence)
 	}
 
-	matrix.Size = image.Rect(0, 0, len(matrix.Points), len(matrix.Points))
+	mx.Size = image.Rect(0, 0, len(mx.Points), len(mx.Points))
+
+	if err := mx.CheckSize(); err != nil {
+		return nil, err
+	}
 
-	return matrix, nil
+	return mx, nil
 }
@@ -0,0 +1,107 @@
+package qrcode
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/encoding/unicode/utf32"
+)
+
+// ECIBinary is the ECI assignment for 8-bit binary data, which is never
+// transcoded.
+const ECIBinary = 899
+
+type eciCharset struct {
+	name     string
+	encoding encoding.Encoding
+}
+
+// eciCharsets maps the ECI assignment numbers of the AIM ECI register to
+// character sets. A nil encoding means the bytes already are UTF-8 or ASCII.
+var eciCharsets = map[int]eciCharset{
+	0:   {"CP437", charmap.CodePage437},
+	1:   {"ISO-8859-1", charmap.ISO8859_1},
+	2:   {"CP437", charmap.CodePage437},
+	3:   {"ISO-8859-1", charmap.ISO8859_1},
+	4:   {"ISO-8859-2", charmap.ISO8859_2},
+	5:   {"ISO-8859-3", charmap.ISO8859_3},
+	6:   {"ISO-8859-4", charmap.ISO8859_4},
+	7:   {"ISO-8859-5", charmap.ISO8859_5},
+	8:   {"ISO-8859-6", charmap.ISO8859_6},
+	9:   {"ISO-8859-7", charmap.ISO8859_7},
+	10:  {"ISO-8859-8", charmap.ISO8859_8},
+	11:  {"ISO-8859-9", charmap.ISO8859_9},
+	12:  {"ISO-8859-10", charmap.ISO8859_10},
+	13:  {"ISO-8859-11", charmap.Windows874},
+	15:  {"ISO-8859-13", charmap.ISO8859_13},
+	16:  {"ISO-8859-14", charmap.ISO8859_14},
+	17:  {"ISO-8859-15", charmap.ISO8859_15},
+	18:  {"ISO-8859-16", charmap.ISO8859_16},
+	20:  {"Shift_JIS", japanese.ShiftJIS},
+	21:  {"windows-1250", charmap.Windows1250},
+	22:  {"windows-1251", charmap.Windows1251},
+	23:  {"windows-1252", charmap.Windows1252},
+	24:  {"windows-1256", charmap.Windows1256},
+	25:  {"UTF-16BE", unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)},
+	26:  {"UTF-8", nil},
+	27:  {"US-ASCII", nil},
+	28:  {"Big5", traditionalchinese.Big5},
+	29:  {"GB18030", simplifiedchinese.GB18030},
+	30:  {"EUC-KR", korean.EUCKR},
+	31:  {"GBK", simplifiedchinese.GBK},
+	32:  {"GB18030", simplifiedchinese.GB18030},
+	33:  {"UTF-16LE", unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)},
+	34:  {"UTF-32BE", utf32.UTF32(utf32.BigEndian, utf32.IgnoreBOM)},
+	35:  {"UTF-32LE", utf32.UTF32(utf32.LittleEndian, utf32.IgnoreBOM)},
+	170: {"US-ASCII", nil},
+}
+
+// ECICharset returns the name of the character set of an ECI assignment.
+func ECICharset(eci int) (string, error) {
+	if eci == ECIBinary {
+		return "binary", nil
+	}
+	charset, ok := eciCharsets[eci]
+	if !ok {
+		return "", fmt.Errorf("ECI %d not supported", eci)
+	}
+	return charset.name, nil
+}
+
+// ECIToUTF8 transcodes bytes of the character set of an ECI assignment to
+// UTF-8. Binary data is returned as is.
+func ECIToUTF8(eci int, raw []byte) ([]byte, error) {
+	if eci == ECIBinary {
+		return raw, nil
+	}
+	charset, ok := eciCharsets[eci]
+	if !ok {
+		return nil, fmt.Errorf("ECI %d not supported", eci)
+	}
+	if charset.encoding == nil {
+		return raw, nil
+	}
+	return charset.encoding.NewDecoder().Bytes(raw)
+}
+
+// ParseECIDesignator reads the ECI designator that follows an ECI mode
+// indicator. The designator is 1, 2 or 3 bytes long, announced by its leading
+// bits 0, 10 or 110, and carries a 7, 14 or 21 bit assignment number.
+func ParseECIDesignator(data []bool) (eci, used int, err error) {
+	switch {
+	case len(data) >= 8 && !data[0]:
+		return Bit2Int(data[1:8]), 8, nil
+	case len(data) >= 16 && data[0] && !data[1]:
+		return Bit2Int(data[2:16]), 16, nil
+	case len(data) >= 24 && data[0] && data[1] && !data[2]:
+		return Bit2Int(data[3:24]), 24, nil
+	}
+	return 0, 0, errors.New("invalid ECI designator")
+}
@@ -0,0 +1,373 @@
+package qrcode
+
+import (
+	"fmt"
+	"image"
+	"strings"
+
+	"github.com/tuotoo/qrcode/reedsolomon"
+)
+
+// Encode encodes content into the smallest symbol that holds it at the
+// recovery level, split into the segments of OptimalSegments.
+func Encode(content []byte, level RecoveryLevel) (*Matrix, error) {
+	matrix, err := encode(func(version int) ([]Segment, error) {
+		return OptimalSegments(content, version)
+	}, level, nil, 40)
+	if err != nil {
+		return nil, err
+	}
+	matrix.Content = string(content)
+	return matrix, nil
+}
+
+// EncodeSegments encodes segments into the smallest symbol that holds them at
+// the recovery level. Only Mode and Data of the segments are used: digits for
+// ModeNumeric, alphanumeric characters for ModeAlphanumeric, any bytes for
+// ModeByte, Shift JIS for ModeKanji and GB2312 for ModeHanzi. The symbol is
+// masked with the pattern of the lowest MaskPenalty. The returned Matrix has
+// the modules in Points, dark modules being true, and the data codewords and
+// segments in Data and Segments.
+func EncodeSegments(segments []Segment, level RecoveryLevel) (*Matrix, error) {
+	return encode(func(int) ([]Segment, error) {
+		return segments, nil
+	}, level, nil, 40)
+}
+
+// encode tries the versions up to maxVersion in turn with the segments
+// segmentsFor returns for them, and encodes the first that fits. A Structured
+// Append header is put in front of the segments when given.
+func encode(segmentsFor func(version int) ([]Segment, error), level RecoveryLevel, header *StructuredAppend, maxVersion int) (*Matrix, error) {
+	for version := 1; version <= maxVersion; version++ {
+		qrCodeVersion := getQRCodeVersion(version, level)
+		if qrCodeVersion == nil {
+			return nil, fmt.Errorf("version %d not found", version)
+		}
+		segments, err := segmentsFor(version)
+		if err != nil {
+			return nil, err
+		}
+		encoded, bits, ok, err := encodeSegments(segments, version)
+		if err != nil {
+			return nil, err
+		}
+		if header != nil {
+			bits = append(header.bits(), bits...)
+		}
+		if !ok || len(bits) > qrCodeVersion.numDataCodewords()*8 {
+			continue
+		}
+		data := padDataCodewords(bits, qrCodeVersion.numDataCodewords()*8, 4)
+		unmasked := buildSymbol(qrCodeVersion, interleaveBlocks(qrCodeVersion, data))
+		matrix := maskSymbol(unmasked, level, bestMask(unmasked, level))
+		matrix.Data = Byte2Bool(data)
+		matrix.Segments = encoded
+		matrix.StructuredAppend = header
+		return matrix, nil
+	}
+	return nil, fmt.Errorf("data too long for a QR code up to version %d", maxVersion)
+}
+
+// getQRCodeVersion looks up the block structure of version at level.
+func getQRCodeVersion(version int, level RecoveryLevel) *QRcodeVersion {
+	for i := range Versions {
+		if Versions[i].Version == version && Versions[i].Level == level {
+			return &Versions[i]
+		}
+	}
+	return nil
+}
+
+// numDataCodewords returns the number of data codewords of all blocks.
+func (v *QRcodeVersion) numDataCodewords() int {
+	n := 0
+	for _, block := range v.Block {
+		n += block.NumBlocks * block.NumDataCodewords
+	}
+	return n
+}
+
+// encodeSegments builds the bit stream of segments for version. It is not ok
+// when a segment has more characters than its character count indicator can
+// declare in version.
+func encodeSegments(segments []Segment, version int) ([]Segment, []bool, bool, error) {
+	format, err := qrStreamFormat(version)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return encodeStreamSegments(segments, format)
+}
+
+// encodeStreamSegments builds the bit stream of segments in format like
+// encodeSegments.
+func encodeStreamSegments(segments []Segment, format *streamFormat) ([]Segment, []bool, bool, error) {
+	var bits []bool
+	var encoded []Segment
+	for _, segment := range segments {
+		segmentBits, count, err := encodeSegmentData(segment.Mode, segment.Data)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		indicator, ok := format.indicator(segment.Mode)
+		if !ok {
+			return nil, nil, false, fmt.Errorf("mode %d not supported", segment.Mode)
+		}
+		countBits := format.encoder.countBits(segment.Mode)
+		if count >= 1<<countBits {
+			return nil, nil, false, nil
+		}
+		header := appendBits(nil, indicator, format.modeBits)
+		if segment.Mode == ModeHanzi {
+			header = appendBits(header, hanziSubsetGB2312, hanziSubsetBits)
+		}
+		header = appendBits(header, count, countBits)
+		segmentBits = append(header, segmentBits...)
+		bits = append(bits, segmentBits...)
+		encoded = append(encoded, Segment{
+			Mode:  segment.Mode,
+			Count: count,
+			Bits:  segmentBits,
+			Data:  append([]byte{}, segment.Data...),
+			ECI:   -1,
+		})
+	}
+	return encoded, bits, true, nil
+}
+
+// encodeSegmentData encodes the characters of a segment of mode and returns
+// them with their number.
+func encodeSegmentData(mode int, data []byte) ([]bool, int, error) {
+	var bits []bool
+	switch mode {
+	case ModeNumeric:
+		if !isDigits(data) {
+			return nil, 0, fmt.Errorf("%q is not numeric", data)
+		}
+		// Three digits make 10 bits, a remaining two 7 and one 4.
+		for i := 0; i < len(data); i += 3 {
+			group := data[i:min(i+3, len(data))]
+			value := 0
+			for _, c := range group {
+				value = value*10 + int(c-'0')
+			}
+			bits = appendBits(bits, value, 3*len(group)+1)
+		}
+		return bits, len(data), nil
+	case ModeAlphanumeric:
+		if !isAlphanumeric(data) {
+			return nil, 0, fmt.Errorf("%q has characters outside of alphanumeric mode", data)
+		}
+		// Two characters make 11 bits, a remaining one 6.
+		for i := 0; i+1 < len(data); i += 2 {
+			value := strings.IndexByte(alphanumericChars, data[i])*45 + strings.IndexByte(alphanumericChars, data[i+1])
+			bits = appendBits(bits, value, 11)
+		}
+		if len(data)%2 == 1 {
+			bits = appendBits(bits, strings.IndexByte(alphanumericChars, data[len(data)-1]), 6)
+		}
+		return bits, len(data), nil
+	case ModeByte:
+		return Byte2Bool(data), len(data), nil
+	case ModeKanji, ModeHanzi:
+		if len(data)%2 != 0 {
+			return nil, 0, fmt.Errorf("odd number of bytes in mode %d", mode)
+		}
+		for i := 0; i < len(data); i += 2 {
+			value, ok := compactDoubleByte(mode, int(data[i])<<8|int(data[i+1]))
+			if !ok {
+				return nil, 0, fmt.Errorf("character %#04x not supported in mode %d", data[i:i+2], mode)
+			}
+			bits = appendBits(bits, value, 13)
+		}
+		return bits, len(data) / 2, nil
+	}
+	return nil, 0, fmt.Errorf("mode %d not supported", mode)
+}
+
+// compactDoubleByte compacts a Shift JIS character for Kanji mode or a GB2312
+// character for Hanzi mode into 13 bits, the reverse of KanjiDecoder and
+// HanziDecoder.
+func compactDoubleByte(mode, code int) (int, bool) {
+	if mode == ModeKanji {
+		switch {
+		case code >= 0x8140 && code <= 0x9ffc:
+			code -= 0x8140
+		case code >= 0xe040 && code <= 0xebbf:
+			code -= 0xc140
+		default:
+			return 0, false
+		}
+		if code&0xff >= 0xc0 {
+			return 0, false
+		}
+		return code>>8*0xc0 + code&0xff, true
+	}
+	switch {
+	case code >= 0xa1a1 && code <= 0xaafe:
+		code -= 0xa1a1
+	case code >= 0xb0a1 && code <= 0xfafe:
+		code -= 0xa6a1
+	default:
+		return 0, false
+	}
+	if code&0xff >= 0x60 {
+		return 0, false
+	}
+	return code>>8*0x60 + code&0xff, true
+}
+
+func isAlphanumeric(b []byte) bool {
+	for _, c := range b {
+		if strings.IndexByte(alphanumericChars, c) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// padDataCodewords ends bits with a terminator of terminatorBits, pads them
+// to a codeword boundary and fills the capacity, in bits, with alternating
+// pad codewords. A last data codeword of 4 bits, as in Micro QR M1 and M3,
+// is left zero in its high nibble.
+func padDataCodewords(bits []bool, capacity, terminatorBits int) []byte {
+	bits = append(bits, make([]bool, min(terminatorBits, capacity-len(bits)))...)
+	bits = append(bits, make([]bool, min((8-len(bits)%8)%8, capacity-len(bits)))...)
+	for i := 0; len(bits)+8 <= capacity; i++ {
+		if i%2 == 0 {
+			bits = appendBits(bits, padCodeword0, 8)
+		} else {
+			bits = appendBits(bits, padCodeword1, 8)
+		}
+	}
+	bits = append(bits, make([]bool, (capacity+7)/8*8-len(bits))...)
+	return Bool2Byte(bits)
+}
+
+// interleaveBlocks splits the data codewords into the blocks of version, adds
+// the error correction codewords of each block and interleaves them the way
+// ParseBlock reads them back.
+func interleaveBlocks(version *QRcodeVersion, data []byte) []byte {
+	var dataBlocks, errorBlocks [][]byte
+	for _, block := range version.Block {
+		for i := 0; i < block.NumBlocks; i++ {
+			dataBlock := data[:block.NumDataCodewords]
+			data = data[block.NumDataCodewords:]
+			dataBlocks = append(dataBlocks, dataBlock)
+			errorBlocks = append(errorBlocks, reedsolomon.Encode(dataBlock, block.NumCodewords-block.NumDataCodewords))
+		}
+	}
+	var codewords []byte
+	for _, blocks := range [][][]byte{dataBlocks, errorBlocks} {
+		for i := 0; ; i++ {
+			n := len(codewords)
+			for _, block := range blocks {
+				if i < len(block) {
+					codewords = append(codewords, block[i])
+				}
+			}
+			if n == len(codewords) {
+				break
+			}
+		}
+	}
+	return codewords
+}
+
+// buildSymbol places the function patterns and version information of
+// version and the unmasked codewords. The format information is left for
+// maskSymbol.
+func buildSymbol(version *QRcodeVersion, codewords []byte) *Matrix {
+	width := version.Version*4 + 17
+	matrix := new(Matrix)
+	for y := 0; y < width; y++ {
+		matrix.Points = append(matrix.Points, make([]bool, width))
+	}
+	set := func(x, y int, dark bool) {
+		matrix.Points[y][x] = dark
+	}
+	maxPos := width - 1
+
+	// Position Detection Patterns; the separators around them stay light.
+	for _, corner := range []Point{{0, 0}, {width - 7, 0}, {0, width - 7}} {
+		for y := 0; y < 7; y++ {
+			for x := 0; x < 7; x++ {
+				ring := x == 0 || x == 6 || y == 0 || y == 6
+				center := x >= 2 && x <= 4 && y >= 2 && y <= 4
+				set(corner.X+x, corner.Y+y, ring || center)
+			}
+		}
+	}
+	// Timing Patterns
+	for i := 8; i < width-8; i++ {
+		set(i, 6, i%2 == 0)
+		set(6, i, i%2 == 0)
+	}
+	// Alignment Patterns
+	Alignments := AlignmentPatternCenter[version.Version]
+	for _, AlignmentX := range Alignments {
+		for _, AlignmentY := range Alignments {
+			if (AlignmentX == 6 && AlignmentY == 6) || (maxPos-AlignmentX == 6 && AlignmentY == 6) || (AlignmentX == 6 && maxPos-AlignmentY == 6) {
+				continue
+			}
+			for y := -2; y <= 2; y++ {
+				for x := -2; x <= 2; x++ {
+					set(AlignmentX+x, AlignmentY+y, max(x, -x, y, -y) != 1)
+				}
+			}
+		}
+	}
+	// The dark module above the bottom left format information.
+	set(8, width-8, true)
+	// Version Information, bit 0 nearest to the top left corner.
+	if version.Version >= 7 {
+		info := version.Version<<12 | bchVersion(version.Version<<12)
+		for i := 0; i < 18; i++ {
+			dark := info>>i&1 == 1
+			set(i/3, width-11+i%3, dark)
+			set(width-11+i%3, i/3, dark)
+		}
+	}
+
+	bits := Byte2Bool(codewords)
+	for i, pos := range DataPositions(matrix.DataArea()) {
+		// Remainder bits behind the last codeword are zero.
+		set(pos.X, pos.Y, i < len(bits) && bits[i])
+	}
+
+	matrix.Size = image.Rect(0, 0, width, width)
+	return matrix
+}
+
+// maskSymbol returns a copy of the unmasked symbol with its data modules
+// masked with mask and the format information of level and mask.
+func maskSymbol(unmasked *Matrix, level RecoveryLevel, mask int) *Matrix {
+	matrix := &Matrix{Points: unmasked.Points.Copy(), Size: unmasked.Size}
+	maskFunc := MaskFunc(mask)
+	for _, pos := range DataPositions(unmasked.DataArea()) {
+		if maskFunc(pos.X, pos.Y) {
+			matrix.Points[pos.Y][pos.X] = !matrix.Points[pos.Y][pos.X]
+		}
+	}
+
+	format := int(level)<<3 | mask
+	info := (format<<10 | bch(format<<10)) ^ 0x5412
+	fi1, fi2 := formatInfoPositions(len(matrix.Points))
+	for i := range fi1 {
+		dark := info>>(14-i)&1 == 1
+		matrix.Points[fi1[i].Y][fi1[i].X] = dark
+		matrix.Points[fi2[i].Y][fi2[i].X] = dark
+	}
+	return matrix
+}
+
+// bchVersion returns the 12 error correction bits of the version information
+// for org, the version shifted left by 12.
+func bchVersion(org int) int {
+	var g = 0x1f25
+	for i := 5; i > -1; i-- {
+		if org&(1<<(uint(i+12))) > 0 {
+			org ^= g << uint(i)
+		}
+	}
+	return org
+}
@@ -0,0 +1,162 @@
+package qrcode
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/tuotoo/qrcode/reedsolomon"
+)
+
+// BlockStats describes how much of the error correction of a single block
+// was spent while decoding it.
+type BlockStats struct {
+	DataCodewords int
+	ECCodewords   int
+
+	// Erasures is the number of codewords decoded as erasures and Errors the
+	// number of codewords corrected at unknown positions.
+	Erasures int
+	Errors   int
+
+	// Corrected is the number of codewords whose value was changed.
+	Corrected int
+
+	// Capacity is the number of unknown errors the block can correct once the
+	// misdecode protection codewords are set aside.
+	Capacity int
+
+	// Margin is the number of further unknown errors the block could have
+	// corrected.
+	Margin int
+}
+
+// NewBlockStats computes the capacity and margin of a block with the given
+// number of data, error correction and misdecode protection codewords.
+func NewBlockStats(dataCodewords, ecCodewords, protection, erasures, errors int) BlockStats {
+	capacity := (ecCodewords - protection) / 2
+	margin := (ecCodewords - protection - erasures - 2*errors) / 2
+	if margin < 0 {
+		margin = 0
+	}
+	return BlockStats{
+		DataCodewords: dataCodewords,
+		ECCodewords:   ecCodewords,
+		Erasures:      erasures,
+		Errors:        errors,
+		Corrected:     erasures + errors,
+		Capacity:      capacity,
+		Margin:        margin,
+	}
+}
+
+// Unused returns the unused error correction of the block as defined by
+// ISO/IEC 18004 K.2.5: 1 - (e + 2t) / (d - p).
+func (b BlockStats) Unused() float64 {
+	available := 2 * b.Capacity
+	if available <= 0 {
+		return 0
+	}
+	unused := 1 - float64(b.Erasures+2*b.Errors)/float64(available)
+	return math.Max(unused, 0)
+}
+
+// ErrorCorrectionStats collects the BlockStats of a symbol.
+type ErrorCorrectionStats struct {
+	Blocks []BlockStats
+}
+
+// Corrected returns the number of codewords corrected over all blocks.
+func (s *ErrorCorrectionStats) Corrected() int {
+	corrected := 0
+	for _, block := range s.Blocks {
+		corrected += block.Corrected
+	}
+	return corrected
+}
+
+// UnusedPercent returns the unused error correction of the symbol in percent.
+// Every block is evaluated independently and the lowest value is reported.
+func (s *ErrorCorrectionStats) UnusedPercent() float64 {
+	if len(s.Blocks) == 0 {
+		return 0
+	}
+	unused := 1.0
+	for _, block := range s.Blocks {
+		unused = math.Min(unused, block.Unused())
+	}
+	return unused * 100
+}
+
+// Grade returns the ISO/IEC 18004 grade of the unused error correction, from
+// "A" (4.0) to "F" (0.0).
+func (s *ErrorCorrectionStats) Grade() string {
+	unused := s.UnusedPercent()
+	switch {
+	case unused >= 62:
+		return "A"
+	case unused >= 50:
+		return "B"
+	case unused >= 37:
+		return "C"
+	case unused >= 25:
+		return "D"
+	}
+	return "F"
+}
+
+func (s *ErrorCorrectionStats) String() string {
+	return fmt.Sprintf("unused error correction %.1f%% (grade %s), %d codewords corrected in %d blocks",
+		s.UnusedPercent(), s.Grade(), s.Corrected(), len(s.Blocks))
+}
+
+// MisdecodeProtection returns the number of error correction codewords the
+// small symbols reserve for error detection only.
+func MisdecodeProtection(version int, level RecoveryLevel) int {
+	switch {
+	case version == 1 && level == Low:
+		return 3
+	case version == 1 && level == Medium, version == 2 && level == Low:
+		return 2
+	case version == 1, version == 3 && level == Low:
+		return 1
+	}
+	return 0
+}
+
+// QRReconstructErasures corrects data and ecc in place like QRReconstruct,
+// with the codewords at the given indexes (counted over data followed by ecc,
+// least confident first) as erasures: as many of them as leave one error
+// correction codeword beyond the protection ones to check the result. When
+// that fails, the block is decoded once more without erasures. The caller
+// checks the erasures and errors corrected against the protection codewords.
+func QRReconstructErasures(data, ecc []byte, erasures []int, protection int) (*reedsolomon.Result, error) {
+	erasures = erasures[:max(min(len(erasures), len(ecc)-protection-1), 0)]
+	received := append(append([]byte{}, data...), ecc...)
+	result, err := reedsolomon.Decode(received, len(ecc), erasures)
+	if err != nil && len(erasures) > 0 {
+		received = append(append(received[:0], data...), ecc...)
+		result, err = reedsolomon.Decode(received, len(ecc), nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	copy(data, received)
+	copy(ecc, received[len(data):])
+	return result, nil
+}
+
+// erasureCandidates returns the indexes whose confidence is below threshold,
+// least confident first.
+func erasureCandidates(confidence []float64, threshold float64) []int {
+	var candidates []int
+	for i, c := range confidence {
+		if c < threshold {
+			candidates = append(candidates, i)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return confidence[candidates[i]] < confidence[candidates[j]]
+	})
+	return candidates
+}
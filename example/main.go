@@ -22,6 +22,7 @@ func main() {
 		return
 	}
 	logger.Println(qrMatrix.Content)
+	logger.Println(qrMatrix.ErrorCorrection)
 	logger.Println(time.Since(startAt))
 }
 
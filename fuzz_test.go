@@ -0,0 +1,147 @@
+package qrcode
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// FuzzDecode feeds encoded image files to Decode. Mutations rarely survive
+// the checksums of PNG, so it mostly exercises readImage and MaxImagePixels;
+// FuzzDecodeImage reaches the detector.
+func FuzzDecode(f *testing.F) {
+	for _, name := range []string{"qrcode5.png", "qrcode10.png", "qr-code-url.png"} {
+		data, err := os.ReadFile(filepath.Join("example", name))
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		qr, err := Decode(bytes.NewReader(data))
+		if err == nil && qr == nil {
+			t.Fatal("nil matrix without error")
+		}
+	})
+}
+
+// FuzzDecodeImage feeds grey images to the detector and samplers. The first
+// two bytes are the width of the image and the rest are its pixels, row by
+// row. Minimizing inputs this large takes most of a minute each, so run it
+// with a short -fuzzminimizetime such as 100x.
+func FuzzDecodeImage(f *testing.F) {
+	qr, err := Encode([]byte("https://github.com/tuotoo/qrcode"), Medium)
+	if err != nil {
+		f.Fatal(err)
+	}
+	micro, err := EncodeMicro([]byte("12345"), Low)
+	if err != nil {
+		f.Fatal(err)
+	}
+	version := &RMQRVersions[16]
+	rmqr := rmqrSymbol(f, version, Medium, rmqrData(f, version, Medium, []Segment{{Mode: ModeAlphanumeric, Data: []byte("RMQR")}}))
+	for _, symbol := range []*Matrix{qr, micro, rmqr} {
+		f.Add(greyPixels(symbol.Image(&RenderOptions{ModuleSize: 2, QuietZone: 2})))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) < 2 {
+			return
+		}
+		width, pix := int(data[0])<<8|int(data[1]), data[2:]
+		if width == 0 || len(pix) < width {
+			return
+		}
+		height := len(pix) / width
+		img := &image.Gray{Pix: pix[:width*height], Stride: width, Rect: image.Rect(0, 0, width, height)}
+		qr, err := DecodeImage(img)
+		if err == nil && qr == nil {
+			t.Fatal("nil matrix without error")
+		}
+		symbols, err := DecodeAllImage(img)
+		for _, symbol := range symbols {
+			if symbol == nil {
+				t.Fatal("nil matrix in results")
+			}
+		}
+		if err == nil && len(symbols) == 0 {
+			t.Fatal("no symbols without error")
+		}
+	})
+}
+
+// greyPixels returns img in the input format of FuzzDecodeImage.
+func greyPixels(img image.Image) []byte {
+	bounds := img.Bounds()
+	data := []byte{byte(bounds.Dx() >> 8), byte(bounds.Dx())}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			grey, _, _, _ := img.At(x, y).RGBA()
+			data = append(data, byte(grey>>8))
+		}
+	}
+	return data
+}
+
+func FuzzParseBlock(f *testing.F) {
+	f.Add(byte(1), byte(Medium), []byte("\x40\x56\x17\x27\x37\x47\x57\x67\x70\xec\x11"), []byte{})
+	f.Add(byte(7), byte(Highest), bytes.Repeat([]byte{0xa5}, 200), []byte{255, 0, 128})
+	f.Fuzz(func(t *testing.T, version, level byte, data, weights []byte) {
+		m := formatMatrix(int(version)%40+1, RecoveryLevel(level%4), 0)
+		var confidence []float64
+		for _, w := range weights {
+			confidence = append(confidence, float64(w)/255)
+		}
+		bits, stats, err := ParseBlock(m, Byte2Bool(data), confidence)
+		if err == nil && (bits == nil || stats == nil) {
+			t.Fatal("nil result without error")
+		}
+	})
+}
+
+func FuzzBits2Bytes(f *testing.F) {
+	f.Add(1, []byte("\x40\x56\x17\x27\x37\x47\x57\x67\x70\xec\x11"))
+	f.Add(1, []byte("\x20\x5b\x0b\x78\xd1\x72\xdc\x4d\x43\x40\xec\x11"))
+	f.Add(10, []byte{0x4f, 0xff, 0xff})
+	f.Fuzz(func(t *testing.T, version int, data []byte) {
+		_, _ = Bits2Bytes(Byte2Bool(data), version)
+
+		report, err := AuditDataStream(Byte2Bool(data), version)
+		if err != nil {
+			return
+		}
+		end := 0
+		for _, span := range report.Spans {
+			if span.Start != end || span.End < span.Start {
+				t.Fatalf("span %+v does not follow bit %d", span, end)
+			}
+			end = span.End
+		}
+		if end != len(data)*8 {
+			t.Fatalf("spans end at bit %d of %d", end, len(data)*8)
+		}
+	})
+}
+
+// formatMatrix returns an empty symbol of the given version whose format
+// information carries level and mask.
+func formatMatrix(version int, level RecoveryLevel, mask int) *Matrix {
+	width := 17 + 4*version
+	m := &Matrix{Points: make(PointsMatrix, width)}
+	for y := range m.Points {
+		m.Points[y] = make([]bool, width)
+	}
+	format := int(level)<<3 | mask
+	bits := (format<<10 | bch(format<<10)) ^ 0x5412
+	positions := []Point{
+		{0, 8}, {1, 8}, {2, 8}, {3, 8},
+		{4, 8}, {5, 8}, {7, 8},
+		{8, 8}, {8, 7}, {8, 5}, {8, 4},
+		{8, 3}, {8, 2}, {8, 1}, {8, 0},
+	}
+	for i, p := range positions {
+		m.Points[p.Y][p.X] = bits>>(14-i)&1 == 1
+	}
+	return m
+}
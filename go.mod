@@ -1,11 +1,12 @@
 module github.com/tuotoo/qrcode
 
-go 1.24
+go 1.24.0
 
 require (
 	github.com/google/uuid v1.3.0
 	github.com/maruel/rs v1.1.0
 	github.com/stretchr/testify v1.10.0
+	golang.org/x/text v0.30.0
 )
 
 require (
@@ -0,0 +1,278 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// GS is the group separator that stands for FNC1 between the elements of a
+// GS1 element string.
+const GS = 0x1d
+
+// gs1CharSet82 is the GS1 AI encodable character set 82, the characters
+// allowed in the values of most AIs.
+const gs1CharSet82 = `!"%&'()*+,-./0123456789:;<=>?ABCDEFGHIJKLMNOPQRSTUVWXYZ_abcdefghijklmnopqrstuvwxyz`
+
+// FNC1 describes the FNC1 mode of a symbol.
+type FNC1 struct {
+	// Position is 1 for GS1 data (FNC1 in first position) and 2 for data
+	// formatted according to an industry application (FNC1 in second
+	// position).
+	Position int
+
+	// ApplicationIndicator identifies the industry application of FNC1 in
+	// second position: two digits or a single letter.
+	ApplicationIndicator string
+}
+
+// ParseApplicationIndicator reads the 8-bit application indicator that
+// follows an FNC1 in second position mode indicator. Values 0 to 99 stand for
+// two digits, letters are encoded as their ASCII value plus 100.
+func ParseApplicationIndicator(data []bool) (string, error) {
+	if len(data) < 8 {
+		return "", errors.New("application indicator too short")
+	}
+	value := Bit2Int(data[0:8])
+	switch {
+	case value < 100:
+		return fmt.Sprintf("%02d", value), nil
+	case value >= 'A'+100 && value <= 'Z'+100, value >= 'a'+100 && value <= 'z'+100:
+		return string(rune(value - 100)), nil
+	}
+	return "", fmt.Errorf("invalid application indicator %d", value)
+}
+
+// FNC1Alphanumeric converts an alphanumeric segment decoded in FNC1 mode: a
+// single % stands for FNC1 and becomes GS, %% stands for a literal %.
+// Byte segments carry GS as is and need no conversion.
+func FNC1Alphanumeric(segment []byte) []byte {
+	var result []byte
+	for i := 0; i < len(segment); i++ {
+		if segment[i] != '%' {
+			result = append(result, segment[i])
+			continue
+		}
+		if i+1 < len(segment) && segment[i+1] == '%' {
+			result = append(result, '%')
+			i++
+			continue
+		}
+		result = append(result, GS)
+	}
+	return result
+}
+
+// GS1Element is one Application Identifier of a GS1 element string with its
+// data.
+type GS1Element struct {
+	AI    string
+	Title string
+	Value string
+}
+
+type gs1AI struct {
+	title string
+	// length is the length of the AI when it is longer than its table key,
+	// for AIs whose last digit is a decimal point position or a variant.
+	length int
+	// fixed is the length of fixed length data, max the maximum length of
+	// variable length data.
+	fixed int
+	max   int
+	// numeric data only has digits.
+	numeric bool
+	// check is the length of the leading digits that end with a GS1 check
+	// digit.
+	check int
+	// date data is YYMMDD.
+	date bool
+}
+
+// gs1AIs lists the Application Identifiers of the GS1 General Specifications
+// found on trade items and logistic units.
+var gs1AIs = map[string]gs1AI{
+	"00":   {title: "SSCC", fixed: 18, numeric: true, check: 18},
+	"01":   {title: "GTIN", fixed: 14, numeric: true, check: 14},
+	"02":   {title: "CONTENT", fixed: 14, numeric: true, check: 14},
+	"10":   {title: "BATCH/LOT", max: 20},
+	"11":   {title: "PROD DATE", fixed: 6, numeric: true, date: true},
+	"12":   {title: "DUE DATE", fixed: 6, numeric: true, date: true},
+	"13":   {title: "PACK DATE", fixed: 6, numeric: true, date: true},
+	"15":   {title: "BEST BEFORE or BEST BY", fixed: 6, numeric: true, date: true},
+	"16":   {title: "SELL BY", fixed: 6, numeric: true, date: true},
+	"17":   {title: "USE BY or EXPIRY", fixed: 6, numeric: true, date: true},
+	"20":   {title: "VARIANT", fixed: 2, numeric: true},
+	"21":   {title: "SERIAL", max: 20},
+	"22":   {title: "CPV", max: 20},
+	"235":  {title: "TPX", max: 28},
+	"240":  {title: "ADDITIONAL ID", max: 30},
+	"241":  {title: "CUST. PART No.", max: 30},
+	"242":  {title: "MTO VARIANT", max: 6, numeric: true},
+	"243":  {title: "PCN", max: 20},
+	"250":  {title: "SECONDARY SERIAL", max: 30},
+	"251":  {title: "REF. TO SOURCE", max: 30},
+	"253":  {title: "GDTI", max: 30, check: 13},
+	"254":  {title: "GLN EXTENSION COMPONENT", max: 20},
+	"255":  {title: "GCN", max: 25, numeric: true, check: 13},
+	"30":   {title: "VAR. COUNT", max: 8, numeric: true},
+	"310":  {title: "NET WEIGHT (kg)", length: 4, fixed: 6, numeric: true},
+	"311":  {title: "LENGTH (m)", length: 4, fixed: 6, numeric: true},
+	"312":  {title: "WIDTH (m)", length: 4, fixed: 6, numeric: true},
+	"313":  {title: "HEIGHT (m)", length: 4, fixed: 6, numeric: true},
+	"314":  {title: "AREA (m²)", length: 4, fixed: 6, numeric: true},
+	"315":  {title: "NET VOLUME (l)", length: 4, fixed: 6, numeric: true},
+	"316":  {title: "NET VOLUME (m³)", length: 4, fixed: 6, numeric: true},
+	"320":  {title: "NET WEIGHT (lb)", length: 4, fixed: 6, numeric: true},
+	"330":  {title: "GROSS WEIGHT (kg)", length: 4, fixed: 6, numeric: true},
+	"37":   {title: "COUNT", max: 8, numeric: true},
+	"390":  {title: "AMOUNT", length: 4, max: 15, numeric: true},
+	"391":  {title: "AMOUNT", length: 4, max: 18, numeric: true},
+	"392":  {title: "PRICE", length: 4, max: 15, numeric: true},
+	"393":  {title: "PRICE", length: 4, max: 18, numeric: true},
+	"400":  {title: "ORDER NUMBER", max: 30},
+	"401":  {title: "GINC", max: 30},
+	"402":  {title: "GSIN", fixed: 17, numeric: true, check: 17},
+	"403":  {title: "ROUTE", max: 30},
+	"410":  {title: "SHIP TO LOC", fixed: 13, numeric: true, check: 13},
+	"411":  {title: "BILL TO", fixed: 13, numeric: true, check: 13},
+	"412":  {title: "PURCHASE FROM", fixed: 13, numeric: true, check: 13},
+	"413":  {title: "SHIP FOR LOC", fixed: 13, numeric: true, check: 13},
+	"414":  {title: "LOC No.", fixed: 13, numeric: true, check: 13},
+	"415":  {title: "PAY TO", fixed: 13, numeric: true, check: 13},
+	"416":  {title: "PROD/SERV LOC", fixed: 13, numeric: true, check: 13},
+	"417":  {title: "PARTY", fixed: 13, numeric: true, check: 13},
+	"420":  {title: "SHIP TO POST", max: 20},
+	"421":  {title: "SHIP TO POST", max: 12},
+	"422":  {title: "ORIGIN", fixed: 3, numeric: true},
+	"7003": {title: "EXPIRY TIME", fixed: 10, numeric: true},
+	"8003": {title: "GRAI", max: 30, check: 14},
+	"8004": {title: "GIAI", max: 30},
+	"8005": {title: "PRICE PER UNIT", fixed: 6, numeric: true},
+	"8006": {title: "ITIP", fixed: 18, numeric: true, check: 14},
+	"8017": {title: "GSRN - PROVIDER", fixed: 18, numeric: true, check: 18},
+	"8018": {title: "GSRN - RECIPIENT", fixed: 18, numeric: true, check: 18},
+	"8020": {title: "REF No.", max: 25},
+	"90":   {title: "INTERNAL", max: 30},
+	"91":   {title: "INTERNAL", max: 90},
+	"92":   {title: "INTERNAL", max: 90},
+	"93":   {title: "INTERNAL", max: 90},
+	"94":   {title: "INTERNAL", max: 90},
+	"95":   {title: "INTERNAL", max: 90},
+	"96":   {title: "INTERNAL", max: 90},
+	"97":   {title: "INTERNAL", max: 90},
+	"98":   {title: "INTERNAL", max: 90},
+	"99":   {title: "INTERNAL", max: 90},
+}
+
+// ParseGS1 splits a GS1 element string, as decoded from a symbol with FNC1 in
+// first position, into its elements. Variable length elements end with GS or
+// with the data. Every element is checked for its length, its characters,
+// its check digit and, for dates, a valid month and day.
+func ParseGS1(data []byte) ([]GS1Element, error) {
+	var elements []GS1Element
+	for len(data) > 0 {
+		if data[0] == GS {
+			data = data[1:]
+			continue
+		}
+
+		var ai gs1AI
+		var key string
+		for n := 2; n <= 4 && n <= len(data); n++ {
+			var ok bool
+			if ai, ok = gs1AIs[string(data[:n])]; ok {
+				key = string(data[:n])
+				break
+			}
+		}
+		if key == "" {
+			return nil, fmt.Errorf("unknown application identifier at %q", data)
+		}
+		length := len(key)
+		if ai.length > length {
+			length = ai.length
+		}
+		if len(data) < length || !isDigits(data[:length]) {
+			return nil, fmt.Errorf("invalid application identifier %q", data[:min(length, len(data))])
+		}
+		element := GS1Element{AI: string(data[:length]), Title: ai.title}
+		data = data[length:]
+
+		if ai.fixed > 0 {
+			if len(data) < ai.fixed {
+				return nil, fmt.Errorf("AI %s: %d characters, want %d", element.AI, len(data), ai.fixed)
+			}
+			element.Value, data = string(data[:ai.fixed]), data[ai.fixed:]
+		} else {
+			end := bytes.IndexByte(data, GS)
+			if end < 0 {
+				end = len(data)
+			}
+			element.Value, data = string(data[:end]), data[end:]
+			if element.Value == "" || len(element.Value) > ai.max {
+				return nil, fmt.Errorf("AI %s: %d characters, want 1 to %d", element.AI, len(element.Value), ai.max)
+			}
+		}
+
+		if err := ai.validate(element.Value); err != nil {
+			return nil, fmt.Errorf("AI %s: %w", element.AI, err)
+		}
+		elements = append(elements, element)
+	}
+	if len(elements) == 0 {
+		return nil, errors.New("empty GS1 element string")
+	}
+	return elements, nil
+}
+
+func (ai gs1AI) validate(value string) error {
+	if ai.numeric && !isDigits([]byte(value)) {
+		return fmt.Errorf("%q is not numeric", value)
+	}
+	if strings.ContainsFunc(value, func(r rune) bool { return !strings.ContainsRune(gs1CharSet82, r) }) {
+		return fmt.Errorf("%q has characters outside of GS1 character set 82", value)
+	}
+	if ai.check > 0 {
+		if len(value) < ai.check || !isDigits([]byte(value[:ai.check])) {
+			return fmt.Errorf("%q does not start with %d digits", value, ai.check)
+		}
+		if !ValidGS1CheckDigit(value[:ai.check]) {
+			return fmt.Errorf("invalid check digit in %q", value[:ai.check])
+		}
+	}
+	if ai.date {
+		month := int(value[2]-'0')*10 + int(value[3]-'0')
+		day := int(value[4]-'0')*10 + int(value[5]-'0')
+		// A day of 00 means the end of the month.
+		if month < 1 || month > 12 || day > 31 {
+			return fmt.Errorf("invalid date %q", value)
+		}
+	}
+	return nil
+}
+
+// ValidGS1CheckDigit reports whether the last digit of digits is the GS1
+// modulo 10 check digit of the digits before it.
+func ValidGS1CheckDigit(digits string) bool {
+	if len(digits) < 2 || !isDigits([]byte(digits)) {
+		return false
+	}
+	sum := 0
+	weight := 3
+	for i := len(digits) - 2; i >= 0; i-- {
+		sum += int(digits[i]-'0') * weight
+		weight = 4 - weight
+	}
+	return (10-sum%10)%10 == int(digits[len(digits)-1]-'0')
+}
+
+func isDigits(b []byte) bool {
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,200 @@
+package qrcode
+
+// Weights of the mask penalty rules of ISO/IEC 18004 7.8.3.1.
+const (
+	penaltyRun      = 3
+	penaltyBlock    = 3
+	penaltyFinder   = 40
+	penaltyBalance  = 10
+	penaltyRunStart = 5
+)
+
+// MaskPenalty scores the modules of a symbol by the four rules ISO/IEC 18004
+// uses to choose a mask pattern; lower is better:
+//
+//  1. runs of 5 or more modules of the same colour in a row or column,
+//     3 points plus 1 for every module beyond 5;
+//  2. 3 points for every 2x2 block of the same colour;
+//  3. 40 points for every 1:1:3:1:1 finder-like pattern in a row or column
+//     with 4 light modules before or after it, the area around the symbol
+//     being light;
+//  4. 10 points for every 5% the share of dark modules deviates from 50%.
+func (mx *Matrix) MaskPenalty() int {
+	width := len(mx.Points)
+	penalty := 0
+	for i := 0; i < width; i++ {
+		row := func(j int) bool { return mx.AtPoints(j, i) }
+		column := func(j int) bool { return mx.AtPoints(i, j) }
+		penalty += runPenalty(row, width) + runPenalty(column, width)
+		penalty += finderPenalty(row, width) + finderPenalty(column, width)
+	}
+
+	dark := 0
+	for y := 0; y < width; y++ {
+		for x := 0; x < width; x++ {
+			if mx.AtPoints(x, y) {
+				dark++
+			}
+			if x+1 < width && y+1 < width {
+				c := mx.AtPoints(x, y)
+				if mx.AtPoints(x+1, y) == c && mx.AtPoints(x, y+1) == c && mx.AtPoints(x+1, y+1) == c {
+					penalty += penaltyBlock
+				}
+			}
+		}
+	}
+	if total := width * width; total > 0 {
+		deviation := dark*2 - total
+		if deviation < 0 {
+			deviation = -deviation
+		}
+		penalty += deviation * 10 / total * penaltyBalance
+	}
+	return penalty
+}
+
+// runPenalty scores the runs of the same colour in a line of length modules.
+func runPenalty(at func(int) bool, length int) int {
+	penalty := 0
+	run := 0
+	for i := 0; i <= length; i++ {
+		if i < length && i > 0 && at(i) == at(i-1) {
+			run++
+			continue
+		}
+		if run >= penaltyRunStart {
+			penalty += penaltyRun + run - penaltyRunStart
+		}
+		run = 1
+	}
+	return penalty
+}
+
+// finderPenalty scores the finder-like patterns in a line of length modules.
+func finderPenalty(at func(int) bool, length int) int {
+	light := func(from, to int) bool {
+		for i := max(from, 0); i < min(to, length); i++ {
+			if at(i) {
+				return false
+			}
+		}
+		return true
+	}
+	penalty := 0
+	for i := 0; i+7 <= length; i++ {
+		if at(i) && !at(i+1) && at(i+2) && at(i+3) && at(i+4) && !at(i+5) && at(i+6) &&
+			(light(i-4, i) || light(i+7, i+11)) {
+			penalty += penaltyFinder
+		}
+	}
+	return penalty
+}
+
+// MaskPenalties scores a symbol under each of the 8 mask patterns: the data
+// modules are unmasked with the mask of the format information, masked again
+// with each pattern and scored by MaskPenalty together with the format
+// information for that pattern. The penalty at the index of the mask in use
+// tells how good the choice of a third-party encoder was.
+func (mx *Matrix) MaskPenalties() ([]int, error) {
+	if err := mx.CheckSize(); err != nil {
+		return nil, err
+	}
+	info, err := mx.FormatInfo()
+	if err != nil {
+		return nil, err
+	}
+	unmasked := &Matrix{Points: mx.Points.Copy()}
+	maskFunc := MaskFunc(info.Mask)
+	for _, pos := range DataPositions(mx.DataArea()) {
+		if maskFunc(pos.X, pos.Y) {
+			unmasked.Points[pos.Y][pos.X] = !unmasked.Points[pos.Y][pos.X]
+		}
+	}
+	return maskPenalties(unmasked, RecoveryLevel(info.ErrorCorrectionLevel)), nil
+}
+
+func maskPenalties(unmasked *Matrix, level RecoveryLevel) []int {
+	penalties := make([]int, 8)
+	for mask := range penalties {
+		penalties[mask] = maskSymbol(unmasked, level, mask).MaskPenalty()
+	}
+	return penalties
+}
+
+// bestMask returns the mask pattern with the lowest penalty, the lowest
+// pattern on a tie.
+func bestMask(unmasked *Matrix, level RecoveryLevel) int {
+	penalties := maskPenalties(unmasked, level)
+	best := 0
+	for mask, penalty := range penalties {
+		if penalty < penalties[best] {
+			best = mask
+		}
+	}
+	return best
+}
+
+// Weight of the edge with fewer dark modules in the mask evaluation of Micro
+// QR, ISO/IEC 18004 7.8.3.2.
+const microMaskWeight = 16
+
+// MicroMaskScore scores the modules of a Micro QR symbol the way ISO/IEC
+// 18004 chooses its mask pattern; higher is better. With SUM1 the dark
+// modules of the right edge and SUM2 those of the bottom edge, the timing
+// patterns left out, the score is 16*SUM1+SUM2 when SUM1 <= SUM2 and
+// 16*SUM2+SUM1 otherwise, so that both edges look like the timing patterns
+// the decoder searches for.
+func (mx *Matrix) MicroMaskScore() int {
+	width := len(mx.Points)
+	right, bottom := 0, 0
+	for i := 1; i < width; i++ {
+		if mx.AtPoints(width-1, i) {
+			right++
+		}
+		if mx.AtPoints(i, width-1) {
+			bottom++
+		}
+	}
+	return min(right, bottom)*microMaskWeight + max(right, bottom)
+}
+
+// MicroMaskScores scores a Micro QR symbol under each of its 4 mask patterns
+// by MicroMaskScore, like MaskPenalties.
+func (mx *Matrix) MicroMaskScores() ([]int, error) {
+	if err := mx.checkMicroSize(); err != nil {
+		return nil, err
+	}
+	info, err := mx.FormatInfo()
+	if err != nil {
+		return nil, err
+	}
+	unmasked := &Matrix{Points: mx.Points.Copy()}
+	maskFunc := MaskFunc(microMasks[info.Mask])
+	for _, pos := range DataPositions(mx.DataArea()) {
+		if maskFunc(pos.X, pos.Y) {
+			unmasked.Points[pos.Y][pos.X] = !unmasked.Points[pos.Y][pos.X]
+		}
+	}
+	return microMaskScores(unmasked, microSymbolNumber(info.MicroVersion, RecoveryLevel(info.ErrorCorrectionLevel))), nil
+}
+
+func microMaskScores(unmasked *Matrix, symbol int) []int {
+	scores := make([]int, len(microMasks))
+	for mask := range scores {
+		scores[mask] = maskMicroSymbol(unmasked, symbol, mask).MicroMaskScore()
+	}
+	return scores
+}
+
+// bestMicroMask returns the Micro QR mask pattern with the highest score, the
+// lowest pattern on a tie.
+func bestMicroMask(unmasked *Matrix, symbol int) int {
+	scores := microMaskScores(unmasked, symbol)
+	best := 0
+	for mask, score := range scores {
+		if score > scores[best] {
+			best = mask
+		}
+	}
+	return best
+}
@@ -0,0 +1,414 @@
+package qrcode
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math/bits"
+
+	"github.com/tuotoo/qrcode/reedsolomon"
+)
+
+// microFormatMask is XORed with the format information of Micro QR.
+const microFormatMask = 0x4445
+
+// microMasks are the mask patterns of Micro QR, numbered 0 to 3, as the mask
+// patterns of QR they equal.
+var microMasks = []int{1, 4, 6, 7}
+
+// IsMicro reports whether Points is as wide and high as a Micro QR symbol, 11
+// to 17 modules.
+func (mx *Matrix) IsMicro() bool {
+	return isMicroWidth(len(mx.Points)) && len(mx.Points[0]) == len(mx.Points)
+}
+
+func isMicroWidth(width int) bool {
+	return width >= 11 && width <= 17 && width%2 == 1
+}
+
+// MicroVersion returns the Micro QR version, 1 to 4 for M1 to M4, of a Micro
+// QR symbol and 0 for any other.
+func (mx *Matrix) MicroVersion() int {
+	if !mx.IsMicro() {
+		return 0
+	}
+	return (len(mx.Points)-11)/2 + 1
+}
+
+// microFormatInfo reads the single copy of the format information of Micro
+// QR: a 3-bit symbol number, the index in MicroVersions, and a 2-bit mask
+// pattern. Up to 3 bit errors are corrected.
+func (mx *Matrix) microFormatInfo() (*FormatInfo, error) {
+	read := mx.GetBin(microFormatInfoPositions())
+	for format := 0; format < 32; format++ {
+		if bits.OnesCount(uint(read^microFormatBits(format))) > 3 {
+			continue
+		}
+		version := MicroVersions[format>>2]
+		if version.Version != mx.MicroVersion() {
+			return nil, fmt.Errorf("format information of M%d in a symbol of M%d", version.Version, mx.MicroVersion())
+		}
+		return &FormatInfo{
+			ErrorCorrectionLevel: int(version.Level),
+			Mask:                 format & 3,
+			MicroVersion:         version.Version,
+		}, nil
+	}
+	return nil, errors.New("not found error correction level and mask")
+}
+
+// microFormatInfoPositions returns the modules of the format information of
+// Micro QR, most significant bit first: along the row under the finder
+// pattern, then up the column to its right.
+func microFormatInfoPositions() []Point {
+	var positions []Point
+	for x := 1; x <= 8; x++ {
+		positions = append(positions, Point{x, 8})
+	}
+	for y := 7; y >= 1; y-- {
+		positions = append(positions, Point{8, y})
+	}
+	return positions
+}
+
+// microFormatBits returns the 15 format information bits of the 5-bit symbol
+// number and mask pattern.
+func microFormatBits(format int) int {
+	return (format<<10 | bch(format<<10)) ^ microFormatMask
+}
+
+// microDataArea marks the modules of a Micro QR symbol that hold data: all
+// but the finder pattern, its separator, the format information and the
+// timing patterns along the top and left edges.
+func (mx *Matrix) microDataArea() *Matrix {
+	da := new(Matrix)
+	for y, line := range mx.Points {
+		l := make([]bool, len(line))
+		for x := range l {
+			l[x] = x > 0 && y > 0 && (x > 8 || y > 8)
+		}
+		da.Points = append(da.Points, l)
+	}
+	return da
+}
+
+// microVersion looks up the block structure of a Micro QR version at level.
+func microVersion(version int, level RecoveryLevel) *QRcodeVersion {
+	symbol := microSymbolNumber(version, level)
+	if symbol < 0 {
+		return nil
+	}
+	return &MicroVersions[symbol]
+}
+
+// microSymbolNumber returns the symbol number of a Micro QR version at level,
+// its index in MicroVersions, or -1 if there is none.
+func microSymbolNumber(version int, level RecoveryLevel) int {
+	for i := range MicroVersions {
+		if MicroVersions[i].Version == version && MicroVersions[i].Level == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// microDataBits returns the number of data bits of a Micro QR version, whose
+// last data codeword has only 4 bits in M1 and M3.
+func microDataBits(version *QRcodeVersion) int {
+	n := version.numDataCodewords() * 8
+	if version.Version%2 == 1 {
+		n -= 4
+	}
+	return n
+}
+
+// microStreamFormat returns the stream format of Micro QR version: M1 only
+// has numeric mode without a mode indicator, M2 adds alphanumeric mode with a
+// 1-bit indicator, M3 and M4 byte and Kanji mode with 2 and 3 bits. The
+// terminator is 3, 5, 7 or 9 bits long. Micro QR has no ECI, FNC1 or
+// Structured Append.
+func microStreamFormat(version int) (*streamFormat, error) {
+	if version < 1 || version > 4 {
+		return nil, fmt.Errorf("invalid micro version %d", version)
+	}
+	encoder := *dataEncoderTypeMap[dataEncoderTypeM1+dataEncoderType(version-1)]
+	return &streamFormat{
+		encoder:        &encoder,
+		modeBits:       version - 1,
+		modes:          []int{ModeNumeric, ModeAlphanumeric, ModeByte, ModeKanji}[:[]int{1, 2, 4, 4}[version-1]],
+		terminatorBits: version*2 + 1,
+	}, nil
+}
+
+// ParseMicroDataStream decodes the data bit stream of a Micro QR symbol of
+// version 1 to 4 like ParseDataStream.
+func ParseMicroDataStream(dataCode []bool, version int) (*DataStream, error) {
+	format, err := microStreamFormat(version)
+	if err != nil {
+		return nil, err
+	}
+	return parseStream(dataCode, format, -1, nil)
+}
+
+// microMisdecodeProtection returns the error correction codewords of a Micro
+// QR version kept back to detect misdecodes. M1 only detects errors.
+func microMisdecodeProtection(version int, level RecoveryLevel) int {
+	switch {
+	case version == 2 && level == Low:
+		return 3
+	case version == 1, version == 2, version == 3 && level == Low, version == 4 && level == Low:
+		return 2
+	}
+	return 0
+}
+
+// sampleMicro samples a Micro QR symbol from its single finder pattern. The
+// symbol extends to the right and down from the finder pattern as far as the
+// timing patterns along its top and left edges.
+func (mx *Matrix) sampleMicro(positionDetectionPattern []*PointGroup) (*Matrix, error) {
+	// A finder pattern is 7 modules wide, its centre 3.
+	lineWidth := LineWidth([][]*PointGroup{positionDetectionPattern}) * 3
+	outer := positionDetectionPattern[1]
+	left, top := float64(outer.Min.X), float64(outer.Min.Y)
+	at := func(x, y float64) bool {
+		return mx.AtOrgPoints(int(left+(x+0.5)*lineWidth), int(top+(y+0.5)*lineWidth))
+	}
+
+	// timing counts the modules of a timing pattern from module 8 on: dark
+	// on even modules, then the light quiet zone.
+	timing := func(dark func(i int) bool) int {
+		i := 8
+		for i < 20 && dark(i) == (i%2 == 0) {
+			i++
+		}
+		return i - 1
+	}
+	width := timing(func(i int) bool { return at(float64(i), 0) })
+	height := timing(func(i int) bool { return at(0, float64(i)) })
+	if width != height || !isMicroWidth(width) {
+		return nil, fmt.Errorf("invalid micro symbol of %d by %d modules", width, height)
+	}
+
+	// The edge of the last timing module gives the module size more
+	// precisely than the finder pattern.
+	edge := func(pos func(p int) bool, from int) float64 {
+		p := from
+		for pos(p + 1) {
+			p++
+		}
+		return float64(p + 1)
+	}
+	row := int(top + lineWidth/2)
+	column := int(left + lineWidth/2)
+	last := float64(width-1) + 0.5
+	moduleX := (edge(func(p int) bool { return mx.AtOrgPoints(p, row) }, int(left+last*lineWidth)) - left) / float64(width)
+	moduleY := (edge(func(p int) bool { return mx.AtOrgPoints(column, p) }, int(top+last*lineWidth)) - top) / float64(width)
+
+	radius := int(min(moduleX, moduleY) / 4)
+	for y := 0; y < width; y++ {
+		var line []bool
+		var confidence []float64
+		for x := 0; x < width; x++ {
+			px := int(left + (float64(x)+0.5)*moduleX)
+			py := int(top + (float64(y)+0.5)*moduleY)
+			line = append(line, mx.AtOrgPoints(px, py))
+			confidence = append(confidence, mx.SampleConfidence(px, py, radius))
+		}
+		mx.Points = append(mx.Points, line)
+		mx.Confidence = append(mx.Confidence, confidence)
+	}
+	mx.Size = image.Rect(0, 0, width, width)
+	return mx, nil
+}
+
+// checkMicroSize returns an error unless Points is a square grid with the
+// width of one of the 4 Micro QR versions.
+func (mx *Matrix) checkMicroSize() error {
+	for _, line := range mx.Points {
+		if len(line) != len(mx.Points) {
+			return errors.New("symbol is not square")
+		}
+	}
+	if !mx.IsMicro() {
+		return fmt.Errorf("invalid micro symbol width %d", len(mx.Points))
+	}
+	return nil
+}
+
+// parseMicroBlock corrects the single block of a Micro QR symbol like
+// ParseBlock. The 4-bit last data codeword of M1 and M3 is read as the high
+// nibble of a byte. As in QR, a block that needs the error correction
+// codewords kept back for misdecode protection is rejected: M1 detects
+// errors but never corrects them.
+func parseMicroBlock(m *Matrix, data []bool, confidence []float64, threshold float64) ([]bool, *ErrorCorrectionStats, error) {
+	if err := m.checkMicroSize(); err != nil {
+		return nil, nil, err
+	}
+	info, err := m.FormatInfo()
+	if err != nil {
+		return nil, nil, err
+	}
+	version := microVersion(info.MicroVersion, RecoveryLevel(info.ErrorCorrectionLevel))
+	if version == nil {
+		return nil, nil, fmt.Errorf("micro version M%d not found", info.MicroVersion)
+	}
+	block := version.Block[0]
+	dataBits := microDataBits(version)
+	numECCodewords := block.NumCodewords - block.NumDataCodewords
+	if len(data) < dataBits+numECCodewords*8 {
+		return nil, nil, fmt.Errorf("got %d data bits, M%d needs %d", len(data), version.Version, dataBits+numECCodewords*8)
+	}
+
+	padding := block.NumDataCodewords*8 - dataBits
+	padded := append(append(append([]bool{}, data[:dataBits]...), make([]bool, padding)...), data[dataBits:]...)
+	if len(confidence) >= dataBits {
+		certain := make([]float64, padding)
+		for i := range certain {
+			certain[i] = 1
+		}
+		confidence = append(append(append([]float64{}, confidence[:dataBits]...), certain...), confidence[dataBits:]...)
+	}
+	codewords := Bool2Byte(padded[:block.NumCodewords*8])
+	weights := codewordWeights(len(codewords), confidence)
+
+	dataBlock := codewords[:block.NumDataCodewords]
+	errorBlock := codewords[block.NumDataCodewords:]
+	protection := microMisdecodeProtection(version.Version, version.Level)
+	corrected, err := QRReconstructErasures(dataBlock, errorBlock, erasureCandidates(weights, threshold), protection)
+	if err != nil {
+		return nil, nil, err
+	}
+	if corrected.Erasures+2*corrected.Errors > numECCodewords-protection {
+		return nil, nil, fmt.Errorf("M%d cannot correct %d erasures and %d errors", version.Version, corrected.Erasures, corrected.Errors)
+	}
+	stats := &ErrorCorrectionStats{Blocks: []BlockStats{
+		NewBlockStats(len(dataBlock), len(errorBlock), protection, corrected.Erasures, corrected.Errors),
+	}}
+	return Byte2Bool(dataBlock)[:dataBits], stats, nil
+}
+
+// EncodeMicro encodes content into the smallest Micro QR symbol that holds it
+// at the recovery level, split into the segments of the fewest bits in the
+// modes of that symbol: numeric only in M1, alphanumeric from M2 on, byte and
+// Kanji from M3 on. Micro QR has the levels Low, Medium and High, High only
+// in M4; at Low M1 comes first, which detects errors but corrects none.
+func EncodeMicro(content []byte, level RecoveryLevel) (*Matrix, error) {
+	matrix, err := encodeMicro(func(format *streamFormat) ([]Segment, error) {
+		return optimalSegments(content, format)
+	}, level)
+	if err != nil {
+		return nil, err
+	}
+	matrix.Content = string(content)
+	return matrix, nil
+}
+
+// EncodeMicroSegments encodes segments into the smallest Micro QR symbol that
+// holds them at the recovery level like EncodeSegments; Hanzi mode is not
+// available. The symbol is masked with the pattern of the highest
+// MicroMaskScore.
+func EncodeMicroSegments(segments []Segment, level RecoveryLevel) (*Matrix, error) {
+	return encodeMicro(func(*streamFormat) ([]Segment, error) {
+		return segments, nil
+	}, level)
+}
+
+// encodeMicro tries the Micro QR versions at level in turn with the segments
+// segmentsFor returns for their stream format, and encodes the first that
+// fits.
+func encodeMicro(segmentsFor func(format *streamFormat) ([]Segment, error), level RecoveryLevel) (*Matrix, error) {
+	var lastErr error
+	found := false
+	for symbol := range MicroVersions {
+		version := &MicroVersions[symbol]
+		if version.Level != level {
+			continue
+		}
+		found = true
+		format, err := microStreamFormat(version.Version)
+		if err != nil {
+			return nil, err
+		}
+		// Content outside of the modes of a small version may fit a larger
+		// one.
+		segments, err := segmentsFor(format)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		encoded, bits, ok, err := encodeStreamSegments(segments, format)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		lastErr = nil
+		capacity := microDataBits(version)
+		if !ok || len(bits) > capacity {
+			continue
+		}
+		data := padDataCodewords(bits, capacity, format.terminatorBits)
+		unmasked := buildMicroSymbol(version, data)
+		matrix := maskMicroSymbol(unmasked, symbol, bestMicroMask(unmasked, symbol))
+		matrix.Data = Byte2Bool(data)[:capacity]
+		matrix.Segments = encoded
+		return matrix, nil
+	}
+	if !found {
+		return nil, fmt.Errorf("no micro QR code at level %d", level)
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, errors.New("data too long for a micro QR code")
+}
+
+// buildMicroSymbol places the finder and timing patterns of a Micro QR
+// version and the unmasked data and error correction codewords. The format
+// information is left for maskMicroSymbol.
+func buildMicroSymbol(version *QRcodeVersion, data []byte) *Matrix {
+	width := version.Version*2 + 9
+	matrix := new(Matrix)
+	for y := 0; y < width; y++ {
+		matrix.Points = append(matrix.Points, make([]bool, width))
+	}
+	// Position Detection Pattern; its separator stays light.
+	for y := 0; y < 7; y++ {
+		for x := 0; x < 7; x++ {
+			ring := x == 0 || x == 6 || y == 0 || y == 6
+			center := x >= 2 && x <= 4 && y >= 2 && y <= 4
+			matrix.Points[y][x] = ring || center
+		}
+	}
+	// Timing Patterns along the top and left edges.
+	for i := 8; i < width; i += 2 {
+		matrix.Points[0][i] = true
+		matrix.Points[i][0] = true
+	}
+
+	block := version.Block[0]
+	ecc := reedsolomon.Encode(data, block.NumCodewords-block.NumDataCodewords)
+	bits := append(Byte2Bool(data)[:microDataBits(version)], Byte2Bool(ecc)...)
+	for i, pos := range DataPositions(matrix.DataArea()) {
+		matrix.Points[pos.Y][pos.X] = bits[i]
+	}
+	matrix.Size = image.Rect(0, 0, width, width)
+	return matrix
+}
+
+// maskMicroSymbol returns a copy of the unmasked Micro QR symbol with its
+// data modules masked with the Micro QR mask pattern and the format
+// information of the symbol number and mask.
+func maskMicroSymbol(unmasked *Matrix, symbol, mask int) *Matrix {
+	matrix := &Matrix{Points: unmasked.Points.Copy(), Size: unmasked.Size}
+	maskFunc := MaskFunc(microMasks[mask])
+	for _, pos := range DataPositions(unmasked.DataArea()) {
+		if maskFunc(pos.X, pos.Y) {
+			matrix.Points[pos.Y][pos.X] = !matrix.Points[pos.Y][pos.X]
+		}
+	}
+	info := microFormatBits(symbol<<2 | mask)
+	for i, pos := range microFormatInfoPositions() {
+		matrix.Points[pos.Y][pos.X] = info>>(14-i)&1 == 1
+	}
+	return matrix
+}
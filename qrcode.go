@@ -2,6 +2,7 @@ package qrcode
 
 import (
 	"errors"
+	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
@@ -10,7 +11,7 @@ import (
 	"math"
 	"os"
 
-	"github.com/maruel/rs"
+	"github.com/tuotoo/qrcode/reedsolomon"
 )
 
 type PositionDetectionPatterns struct {
@@ -49,6 +50,28 @@ type Matrix struct {
 	Size      image.Rectangle
 	Data      []bool
 	Content   string
+	// Raw is the decoded data before ECI transcoding and ECI the ECI
+	// assignment numbers found in the data, in order.
+	Raw []byte
+	ECI []int
+	// StructuredAppend is set when the symbol is one part of a message
+	// split over several symbols; see JoinStructuredAppend.
+	StructuredAppend *StructuredAppend
+	// FNC1 is set for GS1 and industry application data; see ParseGS1.
+	FNC1 *FNC1
+	// Charset is the character set detected for byte data without ECI.
+	Charset string
+	// Segments lists the character segments Content was decoded from.
+	Segments []Segment
+	// Audit accounts for every bit of the data codewords and the remainder
+	// bits.
+	Audit *AuditReport
+	// Confidence holds a value between 0 and 1 for every module in Points
+	// telling how uniform the sampled area was. A nil Confidence means every
+	// module is certain.
+	Confidence [][]float64
+	// ErrorCorrection reports how much error correction decoding used.
+	ErrorCorrection *ErrorCorrectionStats
 }
 
 func (mx *Matrix) AtOrgPoints(x, y int) bool {
@@ -60,17 +83,75 @@ func (mx *Matrix) AtOrgPoints(x, y int) bool {
 	return false
 }
 
+// AtConfidence returns the sampling confidence of the module at x, y.
+func (mx *Matrix) AtConfidence(x, y int) float64 {
+	if y >= 0 && y < len(mx.Confidence) {
+		if x >= 0 && x < len(mx.Confidence[y]) {
+			return mx.Confidence[y][x]
+		}
+	}
+	return 1
+}
+
+// SampleConfidence measures how many of the binarized pixels within radius
+// of x, y agree with the value at x, y, scaled so that a uniform area gives 1
+// and an even split gives 0.
+func (mx *Matrix) SampleConfidence(x, y, radius int) float64 {
+	value := mx.AtOrgPoints(x, y)
+	total, agree := 0, 0
+	for dy := -radius; dy <= radius; dy++ {
+		for dx := -radius; dx <= radius; dx++ {
+			total++
+			if mx.AtOrgPoints(x+dx, y+dy) == value {
+				agree++
+			}
+		}
+	}
+	confidence := 2*float64(agree)/float64(total) - 1
+	if confidence < 0 {
+		return 0
+	}
+	return confidence
+}
+
 type FormatInfo struct {
 	ErrorCorrectionLevel, Mask int
+
+	// MicroVersion is 1 to 4 for the format information of Micro QR M1 to
+	// M4, whose Mask numbers the 4 mask patterns of Micro QR.
+	MicroVersion int
+
+	// RMQRVersion is 1 to 32 for the format information of rMQR, one of
+	// RMQRVersions.
+	RMQRVersion int
 }
 
-func (mx *Matrix) FormatInfo() (*FormatInfo, error) {
-	fi1 := []Point{
+// formatInfoPositions returns the two copies of the format information of a
+// symbol of the given width, most significant bit first.
+func formatInfoPositions(length int) (fi1, fi2 []Point) {
+	fi1 = []Point{
 		{0, 8}, {1, 8}, {2, 8}, {3, 8},
 		{4, 8}, {5, 8}, {7, 8},
 		{8, 8}, {8, 7}, {8, 5}, {8, 4},
 		{8, 3}, {8, 2}, {8, 1}, {8, 0},
 	}
+	fi2 = []Point{
+		{8, length - 1}, {8, length - 2}, {8, length - 3}, {8, length - 4},
+		{8, length - 5}, {8, length - 6}, {8, length - 7},
+		{length - 8, 8}, {length - 7, 8}, {length - 6, 8}, {length - 5, 8},
+		{length - 4, 8}, {length - 3, 8}, {length - 2, 8}, {length - 1, 8},
+	}
+	return fi1, fi2
+}
+
+func (mx *Matrix) FormatInfo() (*FormatInfo, error) {
+	if mx.IsMicro() {
+		return mx.microFormatInfo()
+	}
+	if mx.IsRMQR() {
+		return mx.rmqrFormatInfo()
+	}
+	fi1, fi2 := formatInfoPositions(len(mx.Points))
 	maskedFileData := mx.GetBin(fi1)
 	unmaskFileData := maskedFileData ^ 0x5412
 	if bch(unmaskFileData) == 0 {
@@ -79,13 +160,6 @@ func (mx *Matrix) FormatInfo() (*FormatInfo, error) {
 			Mask:                 unmaskFileData >> 10 & 7,
 		}, nil
 	}
-	length := len(mx.Points)
-	fi2 := []Point{
-		{8, length - 1}, {8, length - 2}, {8, length - 3}, {8, length - 4},
-		{8, length - 5}, {8, length - 6}, {8, length - 7},
-		{length - 8, 8}, {length - 7, 8}, {length - 6, 8}, {length - 5, 8},
-		{length - 4, 8}, {length - 3, 8}, {length - 2, 8}, {length - 1, 8},
-	}
 	maskedFileData = mx.GetBin(fi2)
 	unmaskFileData = maskedFileData ^ 0x5412
 	if bch(unmaskFileData) == 0 {
@@ -97,6 +171,15 @@ func (mx *Matrix) FormatInfo() (*FormatInfo, error) {
 	return nil, errors.New("not found error correction level and mask")
 }
 
+// gridSize returns the number of columns and rows of Points, which differ
+// for rMQR symbols.
+func (mx *Matrix) gridSize() (int, int) {
+	if len(mx.Points) == 0 {
+		return 0, 0
+	}
+	return len(mx.Points[0]), len(mx.Points)
+}
+
 func (mx *Matrix) AtPoints(x, y int) bool {
 	if y >= 0 && y < len(mx.Points) {
 		if x >= 0 && x < len(mx.Points[y]) {
@@ -123,6 +206,21 @@ func (mx *Matrix) Version() int {
 	return (width-21)/4 + 1
 }
 
+// CheckSize returns an error unless Points is a square grid with the width
+// of one of the 40 QR code versions.
+func (mx *Matrix) CheckSize() error {
+	width := len(mx.Points)
+	for _, line := range mx.Points {
+		if len(line) != width {
+			return errors.New("symbol is not square")
+		}
+	}
+	if width < 21 || width > 177 || (width-17)%4 != 0 {
+		return fmt.Errorf("invalid symbol width %d", width)
+	}
+	return nil
+}
+
 type Point struct {
 	X int
 	Y int
@@ -139,6 +237,12 @@ func bch(org int) int {
 }
 
 func (mx *Matrix) DataArea() *Matrix {
+	if mx.IsMicro() {
+		return mx.microDataArea()
+	}
+	if mx.IsRMQR() {
+		return mx.rmqrDataArea()
+	}
 	da := new(Matrix)
 	width := len(mx.Points)
 	maxPos := width - 1
@@ -149,41 +253,40 @@ func (mx *Matrix) DataArea() *Matrix {
 		}
 		da.Points = append(da.Points, l)
 	}
+	// reserve marks a function module, ignoring positions outside a malformed grid.
+	reserve := func(x, y int) {
+		if y >= 0 && y < len(da.Points) && x >= 0 && x < len(da.Points[y]) {
+			da.Points[y][x] = false
+		}
+	}
 	// Position Detection Pattern is a pattern used to mark the size of the QR code rectangle.
 	// These three position detection patterns have white borders called Separators for Position Detection Patterns. The reason for three instead of four is that three can mark a rectangle.
 	for y := 0; y < 9; y++ {
 		for x := 0; x < 9; x++ {
-			if y < len(mx.Points) && x < len(mx.Points[y]) {
-				da.Points[y][x] = false // Top left
-			}
+			reserve(x, y) // Top left
 		}
 	}
 	for y := 0; y < 9; y++ {
 		for x := 0; x < 8; x++ {
-			if y < len(mx.Points) && maxPos-x < len(mx.Points[y]) {
-				da.Points[y][maxPos-x] = false // Top right
-			}
+			reserve(maxPos-x, y) // Top right
 		}
 	}
 	for y := 0; y < 8; y++ {
 		for x := 0; x < 9; x++ {
-			if maxPos-y < len(mx.Points) && x < len(mx.Points[y]) {
-				da.Points[maxPos-y][x] = false // Bottom left
-			}
+			reserve(x, maxPos-y) // Bottom left
 		}
 	}
 	// Timing Patterns are also used for positioning. The reason is that there are 40 sizes of QR codes, and when the size is too large, a standard line is needed, otherwise it may be scanned crookedly.
 	for i := 0; i < width; i++ {
-		if 6 < len(mx.Points) && i < len(mx.Points[6]) {
-			da.Points[6][i] = false
-		}
-		if i < len(mx.Points) && 6 < len(mx.Points[i]) {
-			da.Points[i][6] = false
-		}
+		reserve(i, 6)
+		reserve(6, i)
 	}
 	// Alignment Patterns are needed for QR codes of Version 2 and above (including Version 2), also for positioning.
 	version := da.Version()
-	Alignments := AlignmentPatternCenter[version]
+	var Alignments []int
+	if version >= 1 && version < len(AlignmentPatternCenter) {
+		Alignments = AlignmentPatternCenter[version]
+	}
 	for _, AlignmentX := range Alignments {
 		for _, AlignmentY := range Alignments {
 			if (AlignmentX == 6 && AlignmentY == 6) || (maxPos-AlignmentX == 6 && AlignmentY == 6) || (AlignmentX == 6 && maxPos-AlignmentY == 6) {
@@ -191,9 +294,7 @@ func (mx *Matrix) DataArea() *Matrix {
 			}
 			for y := AlignmentY - 2; y <= AlignmentY+2; y++ {
 				for x := AlignmentX - 2; x <= AlignmentX+2; x++ {
-					if y < len(mx.Points) && x < len(mx.Points[y]) {
-						da.Points[y][x] = false
-					}
+					reserve(x, y)
 				}
 			}
 		}
@@ -202,12 +303,8 @@ func (mx *Matrix) DataArea() *Matrix {
 	if version >= 7 {
 		for i := maxPos - 10; i < maxPos-7; i++ {
 			for j := 0; j < 6; j++ {
-				if i < len(mx.Points) && j < len(mx.Points[i]) {
-					da.Points[i][j] = false
-				}
-				if j < len(mx.Points) && i < len(mx.Points[j]) {
-					da.Points[j][i] = false
-				}
+				reserve(j, i)
+				reserve(i, j)
 			}
 		}
 	}
@@ -251,6 +348,9 @@ func NewPositionDetectionPattern(PDPs [][]*PointGroup) (*PositionDetectionPatter
 			}
 		}
 	}
+	if KF == nil || KL == nil {
+		return nil, errors.New("lost Position Detection Pattern")
+	}
 	positionDetectionPatterns := new(PositionDetectionPatterns)
 	positionDetectionPatterns.TopLeft = KF.FirstPosGroup
 	positionDetectionPatterns.Bottom = KL.LastPosGroup
@@ -453,36 +553,53 @@ func IsPositionDetectionPattern(solidGroup, hollowGroup *PointGroup) bool {
 		hollowCenter.Y > solidMinY && hollowCenter.Y < solidMaxY
 }
 
-func GetData(unmaskMatrix, dataArea *Matrix) []bool {
-	width := len(unmaskMatrix.Points)
+func GetData(unmaskMatrix, dataArea *Matrix) ([]bool, []float64) {
 	var data []bool
+	var confidence []float64
+	for _, pos := range DataPositions(dataArea) {
+		data = append(data, unmaskMatrix.AtPoints(pos.X, pos.Y))
+		confidence = append(confidence, unmaskMatrix.AtConfidence(pos.X, pos.Y))
+	}
+	return data, confidence
+}
+
+// DataPositions lists the modules of dataArea that hold data, in the order
+// the bits are placed: two columns at a time from the right, upwards and
+// downwards in turn, skipping the vertical timing pattern. The timing pattern
+// of Micro QR is the leftmost column, which no pair of columns reaches.
+func DataPositions(dataArea *Matrix) []Point {
+	if dataArea.IsRMQR() {
+		return rmqrDataPositions(dataArea)
+	}
+	width := len(dataArea.Points)
+	var positions []Point
 	maxPos := width - 1
 
 	for t := maxPos; t > 0; {
 		for y := maxPos; y >= 0; y-- {
 			for x := t; x >= t-1; x-- {
 				if dataArea.AtPoints(x, y) {
-					data = append(data, unmaskMatrix.AtPoints(x, y))
+					positions = append(positions, Point{x, y})
 				}
 			}
 		}
-		
+
 		t -= 2
-		if t == 6 {
+		if t == 6 && !isMicroWidth(width) {
 			t -= 1
 		}
 
 		for y := 0; y <= maxPos; y++ {
 			for x := t; x >= t-1 && x >= 0; x-- {
-				if x < len(unmaskMatrix.Points[y]) && dataArea.AtPoints(x, y) {
-					data = append(data, unmaskMatrix.AtPoints(x, y))
+				if dataArea.AtPoints(x, y) {
+					positions = append(positions, Point{x, y})
 				}
 			}
 		}
-		
+
 		t -= 2
 	}
-	return data
+	return positions
 }
 
 func Line(start, end *Point, matrix *Matrix) (line []bool) {
@@ -526,6 +643,9 @@ func Line(start, end *Point, matrix *Matrix) (line []bool) {
 
 // Alignment
 func (mx *Matrix) CenterList(line []bool, offset int) (li []int) {
+	if len(line) == 0 {
+		return nil
+	}
 	subMap := map[int]int{}
 	value := line[0]
 	subLength := 0
@@ -659,9 +779,11 @@ func (mx *Matrix) ReadImage() {
 }
 
 func QRReconstruct(data, ecc []byte) ([]byte, error) {
-	_, err := rs.NewDecoder(rs.QRCodeField256).Decode(data, ecc)
-	if err != nil {
+	received := append(append([]byte{}, data...), ecc...)
+	if _, err := reedsolomon.Decode(received, len(ecc), nil); err != nil {
 		return nil, err
 	}
+	copy(data, received)
+	copy(ecc, received[len(data):])
 	return data, nil
 }
@@ -1,11 +1,26 @@
 package qrcode
 
 import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+
+	"github.com/tuotoo/qrcode/reedsolomon"
 )
 
 func TestDecode(t *testing.T) {
@@ -17,15 +32,26 @@ func TestDecode(t *testing.T) {
 		{in: "qrcode1.png", out: "http://weixin.qq.com/r/2fKmvj-EkmLtrXvd96fL"},
 		{in: "qrcode4.png", out: "http://www.example.org"},
 		{in: "qrcode5.png", out: "a"},
-		{in: "qrcode6.png", out: "abcdefg"},
+		{in: "qrcode6.png", out: "abcdefg12345"},
 		{in: "qrcode7.png", out: "abcdefg"},
 		{in: "qrcode8.png", out: "中文"},
 		{in: "qrcode9.png", out: "abcdefg"},
 		{in: "qrcode10.png", out: "abcdefghijklmnopqrstuvwxyz"}, 
-		{in: "qrcode14.jpeg", out: "AEL-10007-78402-01XXB45EBF1163C414B24AFD062B008024605AA3AB554463147C78A4B0ECA23B1DA80"},
-		{in: "qrcode15.jpeg", out: "AEL-10007-78379-02XX524DBEEF63C414A830F3062A0047E2404ECEAF6E8C1DCCF9E0ED2484355C22EF0"},
+		{in: "qrcode14.jpeg", out: "AEL-10007-78402-01XXB45EBF1163C414B24AFD062B008024605AA3AB554463147C78A4B0ECA23B1DA8"},
+		{in: "qrcode15.jpeg", out: "AEL-10007-78379-02XX524DBEEF63C414A830F3062A0047E2404ECEAF6E8C1DCCF9E0ED2484355C22EF"},
 		// {in: "qrcode16.png", out: "otpauth://totp/MLX-1c17dc67-5475-4f3a-9a0b-c26166a6276e"},
 		{in: "qr-code-url.png", out: "https://text.is/more-than-20-symbols-in-length-around-56"},
+		{in: "qrcode-numeric.png", out: "0123456789012345678"},
+		{in: "qrcode-mixed.png", out: "https://example.com/p/00012345678901234567"},
+		{in: "qrcode-kanji.png", out: "部品番号点茗"},
+		{in: "qrcode-kanji-mixed.png", out: "PN:東京都港区1050011"},
+		{in: "qrcode-hanzi.png", out: "中文二维码，测试！"},
+		{in: "qrcode-alphanumeric.png", out: "HELLO WORLD $%*+-./:0123"},
+		{in: "qrcode-hanzi-mixed.png", out: "SKU:螺丝钉2024"},
+		// rMQR symbols drawn by a separate implementation written from ISO/IEC
+		// 23941, which shares no code with this package.
+		{in: "rmqr-r7x43.png", out: "12345"},
+		{in: "rmqr-r17x139.png", out: "ISO/IEC 23941 rMQR R17x139 cable label"},
 		// {in: "qr_code_new.png", out: "otpauth://totp/MLX-614bb389-1662-4c43-b8f3-f4cdd8c70d35"},
 	}
 	for _, tt := range tests {
@@ -44,3 +70,1780 @@ func TestDecode(t *testing.T) {
 		})
 	}
 }
+
+func TestQRReconstructErasures(t *testing.T) {
+	data := []byte("erasure aware reed-solomon")
+	ecc := reedsolomon.Encode(data, 16)
+
+	// 12 damaged codewords are beyond the 8 unknown errors 16 ECC codewords
+	// can fix, but within reach once they are known erasures.
+	damaged := append([]byte{}, data...)
+	var erasures []int
+	for i := 0; i < 12; i++ {
+		damaged[i*2] ^= 0x5a
+		erasures = append(erasures, i*2)
+	}
+
+	_, err := QRReconstruct(append([]byte{}, damaged...), append([]byte{}, ecc...))
+	require.Error(t, err)
+
+	result, err := QRReconstructErasures(damaged, append([]byte{}, ecc...), erasures, 3)
+	require.NoError(t, err)
+	require.Equal(t, data, damaged)
+	require.Equal(t, 12, result.Erasures)
+	require.Equal(t, 0, result.Errors)
+	require.Equal(t, erasures, result.Positions)
+
+	// Candidates beyond those that leave the 3 protection codewords and one
+	// more to check the result are not used.
+	damaged = append([]byte{}, data...)
+	for _, i := range erasures {
+		damaged[i] ^= 0x5a
+	}
+	result, err = QRReconstructErasures(damaged, append([]byte{}, ecc...), append(erasures, 1, 3, 5, 7), 3)
+	require.NoError(t, err)
+	require.Equal(t, data, damaged)
+	require.Equal(t, 12, result.Erasures)
+
+	// 20 damaged codewords are out of reach however many are erased.
+	damaged = append([]byte{}, data...)
+	erasures = nil
+	for i := 0; i < 20; i++ {
+		damaged[i] ^= 0x5a
+		erasures = append(erasures, i)
+	}
+	_, err = QRReconstructErasures(damaged, append([]byte{}, ecc...), erasures, 0)
+	require.Error(t, err)
+}
+
+func TestDecodeErrorCorrection(t *testing.T) {
+	tests := []struct {
+		in        string
+		corrected int
+		unused    float64
+		grade     string
+	}{
+		{in: "qrcode5.png", corrected: 0, unused: 100, grade: "A"},
+		{in: "qrcode4.png", corrected: 1, unused: 87.5, grade: "A"},
+		// Low confidence codewords are erased, at half the cost of errors.
+		{in: "qrcode.png", corrected: 30, unused: 100 * (1 - 9.0/22), grade: "B"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("example", tt.in))
+			require.NoError(t, err)
+			defer f.Close()
+
+			qr, err := Decode(f)
+			require.NoError(t, err)
+
+			require.Equal(t, tt.corrected, qr.ErrorCorrection.Corrected())
+			require.InDelta(t, tt.unused, qr.ErrorCorrection.UnusedPercent(), 0.01)
+			require.Equal(t, tt.grade, qr.ErrorCorrection.Grade())
+		})
+	}
+}
+
+func TestParseBlockMisdecodeProtection(t *testing.T) {
+	// 1-L has 7 error correction codewords, 3 of them for misdecode
+	// protection only, which leaves 2 errors to correct.
+	version := getQRCodeVersion(1, Low)
+	data := []byte("\x40\x56\x17\x27\x37\x47\x57\x67\x70\xec\x11\xec\x11\xec\x11\xec\x11\xec\x11")
+	require.Len(t, data, version.numDataCodewords())
+	codewords := interleaveBlocks(version, data)
+	m := formatMatrix(1, Low, 0)
+
+	damaged := append([]byte{}, codewords...)
+	damaged[0] ^= 0xff
+	damaged[5] ^= 0x01
+	bits, stats, err := ParseBlock(m, Byte2Bool(damaged), nil)
+	require.NoError(t, err)
+	require.Equal(t, Byte2Bool(data), bits)
+	require.Equal(t, 2, stats.Corrected())
+	require.Equal(t, 0, stats.Blocks[0].Margin)
+
+	// Reed-Solomon alone would correct a third error.
+	damaged[9] ^= 0x80
+	received := append([]byte{}, damaged...)
+	_, err = QRReconstruct(received[:len(data)], received[len(data):])
+	require.NoError(t, err)
+	require.Equal(t, data, received[:len(data)])
+	_, _, err = ParseBlock(m, Byte2Bool(damaged), nil)
+	require.Error(t, err)
+}
+
+func TestParseBlockErasureThreshold(t *testing.T) {
+	version := getQRCodeVersion(1, Low)
+	data := []byte("\x40\x56\x17\x27\x37\x47\x57\x67\x70\xec\x11\xec\x11\xec\x11\xec\x11\xec\x11")
+	damaged := interleaveBlocks(version, data)
+	m := formatMatrix(1, Low, 0)
+
+	// Three damaged codewords are beyond the 2 errors 1-L corrects, but
+	// within reach as erasures.
+	confidence := make([]float64, len(damaged)*8)
+	for i := range confidence {
+		confidence[i] = 1
+	}
+	for _, i := range []int{0, 5, 9} {
+		damaged[i] ^= 0x5a
+		confidence[i*8+3] = 0.3
+	}
+
+	bits, stats, err := parseBlock(m, Byte2Bool(damaged), confidence, new(Decoder).erasureThreshold())
+	require.NoError(t, err)
+	require.Equal(t, Byte2Bool(data), bits)
+	require.Equal(t, 3, stats.Corrected())
+
+	_, _, err = parseBlock(m, Byte2Bool(damaged), confidence, (&Decoder{ErasureThreshold: 0.2}).erasureThreshold())
+	require.Error(t, err)
+	_, _, err = parseBlock(m, Byte2Bool(damaged), confidence, (&Decoder{ErasureThreshold: -1}).erasureThreshold())
+	require.Error(t, err)
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	var blank bytes.Buffer
+	require.NoError(t, png.Encode(&blank, image.NewGray(image.Rect(0, 0, 40, 40))))
+
+	_, err := Decode(bytes.NewReader(nil))
+	require.Error(t, err)
+	_, err = Decode(&blank)
+	require.Error(t, err)
+
+	_, err = Bits2Bytes(nil, 1)
+	require.Error(t, err)
+	_, err = Bits2Bytes([]bool{false, true, false, false, true}, 1)
+	require.Error(t, err)
+	_, err = Bits2Bytes(Byte2Bool([]byte{0x40}), 1)
+	require.Error(t, err)
+
+	_, _, err = ParseBlock(formatMatrix(1, Medium, 0), Byte2Bool([]byte{0x40}), nil)
+	require.Error(t, err)
+	_, _, err = ParseBlock(&Matrix{Points: PointsMatrix{{true}}}, nil, nil)
+	require.Error(t, err)
+}
+
+// appendBits appends the width low bits of value, most significant first.
+// byteSegment returns a byte mode segment with an 8-bit count indicator.
+func byteSegment(s string) []bool {
+	bits := appendBits(nil, 4, 4)
+	bits = appendBits(bits, len(s), 8)
+	for _, c := range []byte(s) {
+		bits = appendBits(bits, int(c), 8)
+	}
+	return bits
+}
+
+func TestBits2BytesSegments(t *testing.T) {
+	terminated := append(append(byteSegment("https://"), byteSegment("example.com")...), appendBits(nil, 0, 4)...)
+	tests := []struct {
+		name string
+		in   []bool
+		out  string
+	}{
+		{name: "single", in: byteSegment("abc"), out: "abc"},
+		{name: "terminated", in: append(terminated, Byte2Bool([]byte{0xec, 0x11})...), out: "https://example.com"},
+		{name: "without terminator", in: append(byteSegment("ab"), byteSegment("cd")...), out: "abcd"},
+		{name: "short tail", in: append(byteSegment("ab"), false, true), out: "ab"},
+		{name: "truncated tail", in: append(byteSegment("ab"), byteSegment("cd")[:20]...), out: "ab"},
+		{name: "unknown tail", in: appendBits(byteSegment("ab"), 0xf, 4), out: "ab"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bt, err := Bits2Bytes(tt.in, 1)
+			require.NoError(t, err)
+			require.Equal(t, tt.out, string(bt))
+		})
+	}
+}
+
+func TestNumericDecoder(t *testing.T) {
+	tests := []struct {
+		name   string
+		groups [][2]int
+		count  int
+		out    string
+		err    bool
+	}{
+		{name: "three digits", groups: [][2]int{{12, 10}}, count: 3, out: "012"},
+		{name: "two digits", groups: [][2]int{{123, 10}, {45, 7}}, count: 5, out: "12345"},
+		{name: "one digit", groups: [][2]int{{999, 10}, {7, 4}}, count: 4, out: "9997"},
+		{name: "group above 999", groups: [][2]int{{1000, 10}}, count: 3, err: true},
+		{name: "pair above 99", groups: [][2]int{{100, 7}}, count: 2, err: true},
+		{name: "digit above 9", groups: [][2]int{{10, 4}}, count: 1, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bits := appendBits(nil, tt.count, 10)
+			for _, g := range tt.groups {
+				bits = appendBits(bits, g[0], g[1])
+			}
+			result, used, err := (&NumericDecoder{countIndicator: 10}).Decode(bits)
+			if tt.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.out, string(result))
+			require.Equal(t, len(bits), used)
+		})
+	}
+}
+
+// appendAlphanumeric appends an alphanumeric segment, without mode indicator,
+// with a 9-bit character count.
+func appendAlphanumeric(bits []bool, s string) []bool {
+	bits = appendBits(bits, len(s), 9)
+	for i := 0; i+1 < len(s); i += 2 {
+		bits = appendBits(bits, strings.IndexByte(alphanumericChars, s[i])*45+strings.IndexByte(alphanumericChars, s[i+1]), 11)
+	}
+	if len(s)%2 == 1 {
+		bits = appendBits(bits, strings.IndexByte(alphanumericChars, s[len(s)-1]), 6)
+	}
+	return bits
+}
+
+func TestAlphanumericDecoder(t *testing.T) {
+	var tests []string
+	// Every pair of characters, which covers every 11-bit value.
+	for _, a := range alphanumericChars {
+		for _, b := range alphanumericChars {
+			tests = append(tests, string(a)+string(b))
+		}
+	}
+	// Every single character, and odd and even lengths.
+	for i := range alphanumericChars {
+		tests = append(tests, alphanumericChars[i:i+1], alphanumericChars[:i], alphanumericChars[i:])
+	}
+	for _, strict := range []bool{false, true} {
+		decoder := &AlphanumericDecoder{countIndicator: 9, Strict: strict}
+		for _, tt := range tests {
+			bits := appendAlphanumeric(nil, tt)
+			// Following data must not be read as part of the segment.
+			result, used, err := decoder.Decode(append(bits, true, false, true, true, false, true))
+			require.NoError(t, err, tt)
+			require.Equal(t, tt, string(result))
+			require.Equal(t, len(bits), used, tt)
+		}
+	}
+}
+
+func TestAlphanumericDecoderInvalid(t *testing.T) {
+	decoder := &AlphanumericDecoder{countIndicator: 9}
+
+	_, _, err := decoder.Decode(appendBits(appendBits(nil, 2, 9), 45*45, 11))
+	require.Error(t, err)
+	_, _, err = decoder.Decode(appendBits(appendBits(nil, 1, 9), 45, 6))
+	require.Error(t, err)
+	_, _, err = decoder.Decode(appendBits(nil, 1, 8))
+	require.Error(t, err)
+
+	// Data shorter than the count is decoded as far as complete characters
+	// go, or rejected in strict mode.
+	bits := appendAlphanumeric(nil, "ABCDE")
+	result, used, err := decoder.Decode(bits[:len(bits)-1])
+	require.NoError(t, err)
+	require.Equal(t, "ABCD", string(result))
+	require.Equal(t, len(bits), used)
+	result, _, err = decoder.Decode(bits[:len(bits)-7])
+	require.NoError(t, err)
+	require.Equal(t, "AB", string(result))
+
+	decoder.Strict = true
+	_, _, err = decoder.Decode(bits[:len(bits)-1])
+	require.EqualError(t, err, "alphanumeric segment of 5 characters needs 37 bits, got 36")
+}
+
+func TestDecoderStrictAlphanumeric(t *testing.T) {
+	// A 1-L symbol whose alphanumeric segment counts 30 characters but holds
+	// the data of 24 and a half.
+	version := getQRCodeVersion(1, Low)
+	bits := appendAlphanumeric(appendBits(nil, 2, 4), strings.Repeat("AB", 15))
+	data := Bool2Byte(bits[:version.numDataCodewords()*8])
+	symbol := maskSymbol(buildSymbol(version, interleaveBlocks(version, data)), Low, 0)
+
+	qr := &Matrix{Points: symbol.Points.Copy()}
+	require.NoError(t, new(Decoder).decodeMatrix(qr))
+	require.Equal(t, strings.Repeat("AB", 12), qr.Content)
+
+	qr = &Matrix{Points: symbol.Points.Copy()}
+	require.Error(t, (&Decoder{StrictAlphanumeric: true}).decodeMatrix(qr))
+}
+
+func TestKanjiDecoder(t *testing.T) {
+	// The example of ISO/IEC 18004 8.4.5: 点 is 0x935F and 茗 is 0xE4AA in
+	// Shift JIS, compacted to 0x0D9F and 0x1AAA.
+	bits := appendBits(nil, 2, 8)
+	bits = appendBits(bits, 0x0d9f, 13)
+	bits = appendBits(bits, 0x1aaa, 13)
+
+	result, used, err := (&KanjiDecoder{countIndicator: 8}).Decode(bits)
+	require.NoError(t, err)
+	require.Equal(t, "点茗", string(result))
+	require.Equal(t, len(bits), used)
+}
+
+func TestHanziDecoder(t *testing.T) {
+	// 中 is 0xD6D0 in GB2312, compacted to 0x30*0x60+0x2F; ！ is 0xA3A1,
+	// from the symbol rows, compacted to 0x02*0x60.
+	bits := appendBits(nil, 1, 4)
+	bits = appendBits(bits, 2, 8)
+	bits = appendBits(bits, 0x30*0x60+0x2f, 13)
+	bits = appendBits(bits, 0x02*0x60, 13)
+
+	result, used, err := (&HanziDecoder{countIndicator: 8}).Decode(bits)
+	require.NoError(t, err)
+	require.Equal(t, "中！", string(result))
+	require.Equal(t, len(bits), used)
+
+	gb, _, err := (&HanziDecoder{countIndicator: 8}).DecodeGB2312(bits)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0xd6, 0xd0, 0xa3, 0xa1}, gb)
+
+	// Only the GB2312 subset is defined.
+	bits[3] = false
+	_, _, err = (&HanziDecoder{countIndicator: 8}).Decode(bits)
+	require.Error(t, err)
+}
+
+func TestDecodeECI(t *testing.T) {
+	tests := []struct {
+		in      string
+		content string
+		raw     []byte
+		eci     []int
+	}{
+		{
+			in:      "qrcode-eci-iso8859-5.png",
+			content: "Привет, мир",
+			raw:     []byte{0xbf, 0xe0, 0xd8, 0xd2, 0xd5, 0xe2, ',', ' ', 0xdc, 0xd8, 0xe0},
+			eci:     []int{7},
+		},
+		{
+			in:      "qrcode-eci-mixed.png",
+			content: "日本語中文Ωmega\x01\x02",
+			raw: []byte{
+				0x93, 0xfa, 0x96, 0x7b, 0x8c, 0xea,
+				0xd6, 0xd0, 0xce, 0xc4,
+				0x03, 0xa9, 0, 'm', 0, 'e', 0, 'g', 0, 'a',
+				0x01, 0x02,
+			},
+			eci: []int{20, 29, 25, ECIBinary},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("example", tt.in))
+			require.NoError(t, err)
+			defer f.Close()
+
+			qr, err := Decode(f)
+			require.NoError(t, err)
+			require.Equal(t, tt.content, qr.Content)
+			require.Equal(t, tt.raw, qr.Raw)
+			require.Equal(t, tt.eci, qr.ECI)
+		})
+	}
+}
+
+func TestParseDataStreamECI(t *testing.T) {
+	byteStream := func(eci int, data []byte) []bool {
+		bits := appendBits(appendBits(nil, modeECI, 4), eci, 8)
+		bits = appendBits(appendBits(bits, ModeByte, 4), len(data), 8)
+		for _, b := range data {
+			bits = appendBits(bits, int(b), 8)
+		}
+		return appendBits(bits, modeTerminator, 4)
+	}
+
+	// GBK.
+	stream, err := ParseDataStream(byteStream(31, []byte{0xd6, 0xd0, 0xce, 0xc4}), 1)
+	require.NoError(t, err)
+	require.Equal(t, "中文", string(stream.Content))
+	charset, err := ECICharset(31)
+	require.NoError(t, err)
+	require.Equal(t, "GBK", charset)
+
+	// An ECI not in the register is kept with its bytes untranscoded.
+	stream, err = ParseDataStream(byteStream(99, []byte{0x80, 'a', 'b'}), 1)
+	require.NoError(t, err)
+	require.Equal(t, []int{99}, stream.ECI)
+	require.Equal(t, []byte{0x80, 'a', 'b'}, stream.Content)
+	require.Equal(t, []byte{0x80, 'a', 'b'}, stream.Raw)
+	require.Equal(t, 99, stream.Segments[0].ECI)
+	_, err = ECICharset(99)
+	require.Error(t, err)
+}
+
+func TestParseECIDesignator(t *testing.T) {
+	tests := []struct {
+		bits      []bool
+		eci, used int
+	}{
+		{bits: appendBits(nil, 26, 8), eci: 26, used: 8},
+		{bits: appendBits(nil, 2<<14|899, 16), eci: 899, used: 16},
+		{bits: appendBits(nil, 6<<21|999999, 24), eci: 999999, used: 24},
+	}
+	for _, tt := range tests {
+		eci, used, err := ParseECIDesignator(tt.bits)
+		require.NoError(t, err)
+		require.Equal(t, tt.eci, eci)
+		require.Equal(t, tt.used, used)
+	}
+
+	_, _, err := ParseECIDesignator(appendBits(nil, 7, 3))
+	require.Error(t, err)
+	_, _, err = ParseECIDesignator(appendBits(nil, 0xff, 8))
+	require.Error(t, err)
+}
+
+func decodeFile(t *testing.T, name string) *Matrix {
+	f, err := os.Open(filepath.Join("example", name))
+	require.NoError(t, err)
+	defer f.Close()
+
+	qr, err := Decode(f)
+	require.NoError(t, err)
+	return qr
+}
+
+func TestStructuredAppend(t *testing.T) {
+	parity := byte(0)
+	for _, b := range []byte("Structured append \x93\xfa\x96\x7b") {
+		parity ^= b
+	}
+
+	var parts []*Matrix
+	for i, name := range []string{"qrcode-sa-1.png", "qrcode-sa-2.png", "qrcode-sa-3.png"} {
+		qr := decodeFile(t, name)
+		require.Equal(t, &StructuredAppend{Index: i, Total: 3, Parity: parity}, qr.StructuredAppend)
+		parts = append(parts, qr)
+	}
+
+	joined, err := JoinStructuredAppend([]*Matrix{parts[2], parts[0], parts[1], parts[0]})
+	require.NoError(t, err)
+	require.Equal(t, "Structured append 日本", string(joined.Content))
+
+	_, err = JoinStructuredAppend([]*Matrix{parts[0], parts[1]})
+	require.EqualError(t, err, "missing part 3 of 3")
+	_, err = JoinStructuredAppend([]*Matrix{parts[2], parts[0]})
+	require.EqualError(t, err, "missing part 2 of 3")
+
+	corrupt := *parts[1]
+	corrupt.Data, corrupt.Raw = nil, []byte("append!")
+	_, err = JoinStructuredAppend([]*Matrix{parts[0], &corrupt, parts[2]})
+	require.ErrorContains(t, err, "parity")
+
+	_, err = JoinStructuredAppend([]*Matrix{parts[0], decodeFile(t, "qrcode5.png")})
+	require.Error(t, err)
+}
+
+func TestStructuredAppendSplitCharacter(t *testing.T) {
+	tests := []struct {
+		content []byte
+		split   int
+		charset string
+		out     string
+	}{
+		{content: []byte("日本語"), split: 4, charset: CharsetUTF8, out: "日本語"},
+		{content: []byte("\x93\xfa\x96\x7b\x8c\xea"), split: 3, charset: CharsetShiftJIS, out: "日本語"},
+	}
+	for _, tt := range tests {
+		var parity byte
+		for _, b := range tt.content {
+			parity ^= b
+		}
+		var symbols []*Matrix
+		for i, part := range [][]byte{tt.content[:tt.split], tt.content[tt.split:]} {
+			header := &StructuredAppend{Index: i, Total: 2, Parity: parity}
+			symbol, err := encode(func(int) ([]Segment, error) {
+				return []Segment{{Mode: ModeByte, Data: part}}, nil
+			}, Medium, header, 40)
+			require.NoError(t, err)
+			symbols = append(symbols, decodeEncoded(t, symbol))
+		}
+		joined, err := JoinStructuredAppend(symbols)
+		require.NoError(t, err)
+		require.Equal(t, tt.out, string(joined.Content))
+		require.Equal(t, tt.content, joined.Raw)
+		require.Equal(t, tt.charset, joined.Charset)
+	}
+}
+
+func TestDecodeAll(t *testing.T) {
+	f, err := os.Open(filepath.Join("example", "qrcode-sa-all.png"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	symbols, err := DecodeAll(f)
+	require.NoError(t, err)
+	require.Len(t, symbols, 3)
+
+	joined, err := JoinStructuredAppend(symbols)
+	require.NoError(t, err)
+	require.Equal(t, "Structured append 日本", string(joined.Content))
+}
+
+func TestDecodeAllSingle(t *testing.T) {
+	f, err := os.Open(filepath.Join("example", "qrcode5.png"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	symbols, err := DecodeAll(f)
+	require.NoError(t, err)
+	require.Len(t, symbols, 1)
+	require.Nil(t, symbols[0].StructuredAppend)
+}
+
+func TestDecodeFNC1(t *testing.T) {
+	qr := decodeFile(t, "qrcode-gs1.png")
+	require.Equal(t, &FNC1{Position: 1}, qr.FNC1)
+	require.Equal(t, "010950110153000317261231"+"10AB-123\x1d2112345", qr.Content)
+
+	elements, err := ParseGS1([]byte(qr.Content))
+	require.NoError(t, err)
+	require.Equal(t, []GS1Element{
+		{AI: "01", Title: "GTIN", Value: "09501101530003"},
+		{AI: "17", Title: "USE BY or EXPIRY", Value: "261231"},
+		{AI: "10", Title: "BATCH/LOT", Value: "AB-123"},
+		{AI: "21", Title: "SERIAL", Value: "12345"},
+	}, elements)
+
+	// In alphanumeric mode % stands for FNC1 and %% for a literal %.
+	qr = decodeFile(t, "qrcode-gs1-alphanumeric.png")
+	require.Equal(t, &FNC1{Position: 1}, qr.FNC1)
+	require.Equal(t, "010950110153000317261231"+"10AB-123\x1d2112345%", qr.Content)
+	elements, err = ParseGS1([]byte(qr.Content))
+	require.NoError(t, err)
+	require.Equal(t, GS1Element{AI: "21", Title: "SERIAL", Value: "12345%"}, elements[3])
+
+	qr = decodeFile(t, "qrcode-fnc1-second.png")
+	require.Equal(t, &FNC1{Position: 2, ApplicationIndicator: "A"}, qr.FNC1)
+	require.Equal(t, "ITEM-42", qr.Content)
+}
+
+func TestFNC1Alphanumeric(t *testing.T) {
+	require.Equal(t, []byte("10ABC\x1d2112"), FNC1Alphanumeric([]byte("10ABC%2112")))
+	require.Equal(t, []byte("10A%B\x1d"), FNC1Alphanumeric([]byte("10A%%B%")))
+}
+
+func TestParseApplicationIndicator(t *testing.T) {
+	for value, want := range map[int]string{0: "00", 37: "37", 99: "99", 'A' + 100: "A", 'z' + 100: "z"} {
+		indicator, err := ParseApplicationIndicator(appendBits(nil, value, 8))
+		require.NoError(t, err)
+		require.Equal(t, want, indicator)
+	}
+	for _, value := range []int{100, 'A' + 99, 'Z' + 101, 255} {
+		_, err := ParseApplicationIndicator(appendBits(nil, value, 8))
+		require.Error(t, err, value)
+	}
+}
+
+func TestParseGS1(t *testing.T) {
+	elements, err := ParseGS1([]byte("00106141411234567897" + "3103000750" + "\x1d8003012345678900051A"))
+	require.NoError(t, err)
+	require.Equal(t, []GS1Element{
+		{AI: "00", Title: "SSCC", Value: "106141411234567897"},
+		{AI: "3103", Title: "NET WEIGHT (kg)", Value: "000750"},
+		{AI: "8003", Title: "GRAI", Value: "012345678900051A"},
+	}, elements)
+
+	for _, in := range []string{
+		"",
+		"0109501101530004",             // check digit
+		"01095011015300",               // too short
+		"17261301",                     // month
+		"10" + strings.Repeat("A", 21), // too long
+		"10\x1d21",                     // empty
+		"30ABC",                        // not numeric
+		"88123",                        // unknown AI
+		"10A B",                        // space
+	} {
+		_, err := ParseGS1([]byte(in))
+		require.Error(t, err, in)
+	}
+
+	// Printable ASCII outside of character set 82.
+	for _, c := range "#$@[\\]^`" {
+		_, err := ParseGS1([]byte("10A" + string(c)))
+		require.Error(t, err, string(c))
+	}
+	elements, err = ParseGS1([]byte(`10!"%&'()*+,-./:;<=>?_`))
+	require.NoError(t, err)
+	require.Equal(t, `!"%&'()*+,-./:;<=>?_`, elements[0].Value)
+}
+
+func TestValidGS1CheckDigit(t *testing.T) {
+	require.True(t, ValidGS1CheckDigit("09501101530003"))
+	require.True(t, ValidGS1CheckDigit("4006381333931"))
+	require.False(t, ValidGS1CheckDigit("4006381333932"))
+	require.False(t, ValidGS1CheckDigit("400638133393X"))
+}
+
+func TestDecodeCharset(t *testing.T) {
+	tests := []struct {
+		in, content, charset string
+	}{
+		{in: "qrcode8.png", content: "中文", charset: CharsetUTF8},
+		{in: "qrcode-sjis.png", content: "こんにちは世界", charset: CharsetShiftJIS},
+		{in: "qrcode-gbk.png", content: "二维码测试", charset: CharsetGB18030},
+		{in: "qrcode-latin1.png", content: "Grüße aus Köln", charset: CharsetISO88591},
+		{in: "qrcode-eci-iso8859-5.png", content: "Привет, мир", charset: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			qr := decodeFile(t, tt.in)
+			require.Equal(t, tt.content, qr.Content)
+			require.Equal(t, tt.charset, qr.Charset)
+		})
+	}
+	qr := decodeFile(t, "qrcode-sjis.png")
+	require.Equal(t, []byte("\x82\xb1\x82\xf1\x82\xc9\x82\xbf\x82\xcd\x90\xa2\x8aE"), qr.Raw)
+}
+
+func TestDetectCharset(t *testing.T) {
+	tests := []struct {
+		in      []byte
+		charset string
+	}{
+		{in: []byte("plain ASCII"), charset: CharsetUTF8},
+		{in: []byte("naïve"), charset: CharsetUTF8},
+		{in: []byte{0x92, 0x86, 0x95, 0xb6}, charset: CharsetShiftJIS},             // 中文
+		{in: []byte{0xd6, 0xd0, 0xce, 0xc4}, charset: CharsetGB18030},              // 中文
+		{in: []byte{0x83, 0x65, 0x83, 0x58, 0x83, 0x67}, charset: CharsetShiftJIS}, // テスト
+		{in: []byte("caf\xe9"), charset: CharsetISO88591},
+		{in: []byte("\xa9 2024 \xabquoted\xbb"), charset: CharsetISO88591},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.charset, DetectCharset(tt.in), "%q", tt.in)
+	}
+}
+
+func TestDecodeSegments(t *testing.T) {
+	qr := decodeFile(t, "qrcode-kanji-mixed.png")
+	require.Len(t, qr.Segments, 3)
+
+	var bits []bool
+	for i, want := range []Segment{
+		{Mode: ModeByte, Count: 3, Data: []byte("PN:"), ECI: -1},
+		{Mode: ModeKanji, Count: 5, Data: []byte("\x93\x8c\x8b\x9e\x93s\x8d`\x8b\xe6"), ECI: -1},
+		{Mode: ModeNumeric, Count: 7, Data: []byte("1050011"), ECI: -1},
+	} {
+		got := qr.Segments[i]
+		require.Equal(t, want.Mode, got.Mode)
+		require.Equal(t, want.Count, got.Count)
+		require.Equal(t, want.Data, got.Data)
+		require.Equal(t, want.ECI, got.ECI)
+		require.Equal(t, want.Mode, Bit2Int(got.Bits[:4]))
+		bits = append(bits, got.Bits...)
+	}
+	require.Equal(t, []int{36, 77, 38}, []int{len(qr.Segments[0].Bits), len(qr.Segments[1].Bits), len(qr.Segments[2].Bits)})
+	// The segments reproduce the bit stream up to the terminator.
+	require.Equal(t, qr.Data[:len(bits)], bits)
+
+	qr = decodeFile(t, "qrcode-eci-mixed.png")
+	var ecis []int
+	for _, segment := range qr.Segments {
+		require.Equal(t, ModeByte, segment.Mode)
+		ecis = append(ecis, segment.ECI)
+	}
+	require.Equal(t, []int{20, 29, 25, ECIBinary}, ecis)
+}
+
+func TestAuditDataStream(t *testing.T) {
+	// "123" in numeric mode is 24 bits, followed by the terminator, 4 bits of
+	// padding to the codeword boundary and the pad codewords.
+	numeric := appendBits(appendBits(appendBits(nil, 1, 4), 3, 10), 123, 10)
+	numeric = numeric[:len(numeric):len(numeric)]
+	padded := func(codewords ...int) []bool {
+		bits := appendBits(numeric, 0, 8)
+		for _, c := range codewords {
+			bits = appendBits(bits, c, 8)
+		}
+		return bits
+	}
+	tests := []struct {
+		name  string
+		bits  []bool
+		kinds []AuditKind
+		want  AuditReport
+	}{
+		{
+			name:  "standard",
+			bits:  padded(0xec, 0x11, 0xec),
+			kinds: []AuditKind{AuditSegment, AuditTerminator, AuditBitPadding, AuditPadCodeword, AuditPadCodeword, AuditPadCodeword},
+			want:  AuditReport{Terminated: true},
+		},
+		{
+			name:  "hidden data",
+			bits:  padded(0xec, 'h', 'i'),
+			kinds: []AuditKind{AuditSegment, AuditTerminator, AuditBitPadding, AuditPadCodeword, AuditTrailing},
+			want:  AuditReport{Terminated: true, TrailingData: true},
+		},
+		{
+			name:  "zero padding",
+			bits:  padded(0, 0),
+			kinds: []AuditKind{AuditSegment, AuditTerminator, AuditBitPadding, AuditPadCodeword, AuditPadCodeword},
+			want:  AuditReport{Terminated: true, NonStandardPadding: true},
+		},
+		{
+			name:  "bit padding set",
+			bits:  append(appendBits(numeric, 0, 4), true, false, false, false),
+			kinds: []AuditKind{AuditSegment, AuditTerminator, AuditBitPadding},
+			want:  AuditReport{Terminated: true, NonStandardPadding: true},
+		},
+		{
+			name:  "full capacity",
+			bits:  byteSegment("abc"),
+			kinds: []AuditKind{AuditSegment},
+			want:  AuditReport{Terminated: true},
+		},
+		{
+			name:  "short terminator",
+			bits:  appendBits(byteSegment("abc"), 0, 2),
+			kinds: []AuditKind{AuditSegment, AuditTerminator},
+			want:  AuditReport{Terminated: true},
+		},
+		{
+			name:  "undecodable segment",
+			bits:  appendBits(appendBits(byteSegment("abc"), 0xf, 4), 0, 4),
+			kinds: []AuditKind{AuditSegment, AuditTrailing},
+			want:  AuditReport{TrailingData: true},
+		},
+		{
+			name:  "count too large",
+			bits:  byteSegment("abc")[:30],
+			kinds: []AuditKind{AuditSegment},
+			want:  AuditReport{CountMismatch: true},
+		},
+		{
+			name:  "later segment too long",
+			bits:  append(byteSegment("abc"), byteSegment("defgh")[:30]...),
+			kinds: []AuditKind{AuditSegment, AuditTrailing},
+			want:  AuditReport{TrailingData: true, CountMismatch: true},
+		},
+		{
+			name:  "header",
+			bits:  append(appendBits(appendBits(nil, 7, 4), 26, 8), appendBits(appendBits(byteSegment("abc"), 0, 8), 0xec, 8)...),
+			kinds: []AuditKind{AuditHeader, AuditSegment, AuditTerminator, AuditBitPadding, AuditPadCodeword},
+			want:  AuditReport{Terminated: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := AuditDataStream(tt.bits, 1)
+			require.NoError(t, err)
+
+			var kinds []AuditKind
+			end := 0
+			for _, span := range report.Spans {
+				require.Equal(t, end, span.Start)
+				end = span.End
+				kinds = append(kinds, span.Kind)
+			}
+			require.Equal(t, len(tt.bits), end)
+			require.Equal(t, tt.kinds, kinds)
+
+			require.Equal(t, tt.want.Terminated, report.Terminated)
+			require.Equal(t, tt.want.NonStandardPadding, report.NonStandardPadding)
+			require.Equal(t, tt.want.TrailingData, report.TrailingData)
+			require.Equal(t, tt.want.CountMismatch, report.CountMismatch)
+			clean := tt.want.Terminated && !tt.want.NonStandardPadding && !tt.want.TrailingData && !tt.want.CountMismatch
+			require.Equal(t, clean, report.Clean())
+		})
+	}
+}
+
+func TestDecodeAudit(t *testing.T) {
+	qr := decodeFile(t, "qrcode-mixed.png")
+	require.True(t, qr.Audit.Clean(), qr.Audit.String())
+	require.Len(t, qr.Audit.Remainder, 7)
+	require.Equal(t, 0, qr.Audit.Spans[0].Segment)
+	require.Equal(t, 1, qr.Audit.Spans[1].Segment)
+	require.Equal(t, len(qr.Data), qr.Audit.Spans[len(qr.Audit.Spans)-1].End)
+
+	// This encoder pads with zero codewords instead of 0xEC and 0x11.
+	qr = decodeFile(t, "qrcode14.jpeg")
+	require.True(t, qr.Audit.NonStandardPadding)
+	require.False(t, qr.Audit.TrailingData)
+	require.Contains(t, qr.Audit.String(), "non-standard padding")
+}
+
+// decodeEncoded decodes the modules of an encoded symbol.
+func decodeEncoded(t *testing.T, encoded *Matrix) *Matrix {
+	t.Helper()
+	qr := &Matrix{Points: encoded.Points.Copy()}
+	require.NoError(t, new(Decoder).decodeMatrix(qr))
+	return qr
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		content string
+		modes   []int
+		version int
+	}{
+		{content: "01234567", modes: []int{ModeNumeric}, version: 1},
+		{content: "HELLO WORLD", modes: []int{ModeAlphanumeric}, version: 1},
+		{content: "https://github.com/tuotoo/qrcode", modes: []int{ModeByte}, version: 2},
+		{content: "", version: 1},
+		{content: strings.Repeat("0123456789", 40), modes: []int{ModeNumeric}, version: 8},
+		{content: strings.Repeat("Hello, 世界! ", 50), modes: []int{ModeByte}, version: 19},
+		{content: "HTTPS://EXAMPLE.COM/P/00012345678901234567", modes: []int{ModeAlphanumeric, ModeNumeric}, version: 2},
+	}
+	for _, tt := range tests {
+		for _, level := range []RecoveryLevel{Low, Medium, High, Highest} {
+			encoded, err := Encode([]byte(tt.content), level)
+			require.NoError(t, err)
+			var modes []int
+			for _, segment := range encoded.Segments {
+				modes = append(modes, segment.Mode)
+			}
+			require.Equal(t, tt.modes, modes, tt.content)
+			if level == Low {
+				require.Equal(t, tt.version, encoded.Version(), tt.content)
+			}
+
+			qr := decodeEncoded(t, encoded)
+			require.Equal(t, tt.content, qr.Content)
+			require.Equal(t, encoded.Data, qr.Data)
+			require.True(t, qr.Audit.Clean(), qr.Audit.String())
+			info, err := qr.FormatInfo()
+			require.NoError(t, err)
+			require.Equal(t, int(level), info.ErrorCorrectionLevel)
+		}
+	}
+}
+
+// annexISymbol is the symbol of the encoding example of ISO/IEC 18004 Annex
+// I, "01234567" in version 1-M with mask 010, module for module as the
+// independent encoder rsc.io/qr draws it.
+var annexISymbol = []string{
+	"#######..#.##.#######",
+	"#.....#..####.#.....#",
+	"#.###.#.#.....#.###.#",
+	"#.###.#.##....#.###.#",
+	"#.###.#.#.###.#.###.#",
+	"#.....#.#...#.#.....#",
+	"#######.#.#.#.#######",
+	"........#..##........",
+	"#.#####..#..#.#####..",
+	"...#.#.##.#.#..#.##..",
+	"..#...##.#.#.#..#####",
+	"....#....#.....####..",
+	"...######..#.#..#....",
+	"........#.#####..##..",
+	"#######..##.#.##.....",
+	"#.....#.#.#####...#.#",
+	"#.###.#.#...#..#.##..",
+	"#.###.#.##..#..#.....",
+	"#.###.#.#.##.#..#.#..",
+	"#.....#........##.##.",
+	"#######.####.#..#.#..",
+}
+
+func TestEncodeAnnexI(t *testing.T) {
+	golden := make(PointsMatrix, len(annexISymbol))
+	for y, row := range annexISymbol {
+		for _, c := range row {
+			golden[y] = append(golden[y], c == '#')
+		}
+	}
+
+	_, bits, ok, err := encodeSegments([]Segment{{Mode: ModeNumeric, Data: []byte("01234567")}}, 1)
+	require.NoError(t, err)
+	require.True(t, ok)
+	version := getQRCodeVersion(1, Medium)
+	data := padDataCodewords(bits, version.numDataCodewords()*8, 4)
+	require.Equal(t, []byte{
+		0x10, 0x20, 0x0c, 0x56, 0x61, 0x80, 0xec, 0x11,
+		0xec, 0x11, 0xec, 0x11, 0xec, 0x11, 0xec, 0x11,
+	}, data)
+	codewords := interleaveBlocks(version, data)
+	require.Equal(t, []byte{0xa5, 0x24, 0xd4, 0xc1, 0xed, 0x36, 0xc7, 0x87, 0x2c, 0x55}, codewords[len(data):])
+
+	symbol := maskSymbol(buildSymbol(version, codewords), Medium, 2)
+	require.Equal(t, golden, symbol.Points)
+
+	encoded, err := Encode([]byte("01234567"), Medium)
+	require.NoError(t, err)
+	require.Equal(t, golden, encoded.Points)
+}
+
+func TestEncodeSegments(t *testing.T) {
+	kanji, err := japanese.ShiftJIS.NewEncoder().Bytes([]byte("漢字"))
+	require.NoError(t, err)
+	hanzi, err := simplifiedchinese.GBK.NewEncoder().Bytes([]byte("汉字"))
+	require.NoError(t, err)
+	encoded, err := EncodeSegments([]Segment{
+		{Mode: ModeKanji, Data: kanji},
+		{Mode: ModeAlphanumeric, Data: []byte("ABC-123")},
+		{Mode: ModeHanzi, Data: hanzi},
+	}, Medium)
+	require.NoError(t, err)
+	require.Equal(t, "漢字ABC-123汉字", decodeEncoded(t, encoded).Content)
+
+	_, err = EncodeSegments([]Segment{{Mode: ModeNumeric, Data: []byte("12a")}}, Medium)
+	require.Error(t, err)
+	_, err = EncodeSegments([]Segment{{Mode: ModeKanji, Data: []byte("ab")}}, Medium)
+	require.Error(t, err)
+	_, err = Encode(make([]byte, 3000), Low)
+	require.Error(t, err)
+}
+
+func TestMaskPenalty(t *testing.T) {
+	line := func(s string) (func(int) bool, int) {
+		return func(i int) bool { return s[i] == '#' }, len(s)
+	}
+	for _, tt := range []struct {
+		line         string
+		run, finders int
+	}{
+		{line: "#.#.#.#", run: 0, finders: 0},
+		{line: "#####..", run: 3, finders: 0},
+		{line: "........#", run: 3 + 3, finders: 0},
+		{line: "#.###.#", run: 0, finders: 40},
+		{line: "#.###.#....#", run: 0, finders: 40},
+		{line: "#..#.###.#.#", run: 0, finders: 0},
+		{line: "#.###.#.#.###.#", run: 0, finders: 80},
+	} {
+		at, length := line(tt.line)
+		require.Equal(t, tt.run, runPenalty(at, length), tt.line)
+		require.Equal(t, tt.finders, finderPenalty(at, length), tt.line)
+	}
+
+	symbol := func(dark func(x, y int) bool) *Matrix {
+		mx := new(Matrix)
+		for y := 0; y < 21; y++ {
+			mx.Points = append(mx.Points, make([]bool, 21))
+			for x := range mx.Points[y] {
+				mx.Points[y][x] = dark(x, y)
+			}
+		}
+		return mx
+	}
+	// 42 runs of 21, 400 blocks and no dark module at all.
+	require.Equal(t, 42*(3+16)+400*3+100, symbol(func(x, y int) bool { return false }).MaskPenalty())
+	require.Equal(t, 0, symbol(MaskFunc(0)).MaskPenalty())
+}
+
+func TestMaskPenalties(t *testing.T) {
+	encoded, err := Encode([]byte("https://github.com/tuotoo/qrcode"), Medium)
+	require.NoError(t, err)
+	penalties, err := encoded.MaskPenalties()
+	require.NoError(t, err)
+	require.Len(t, penalties, 8)
+	info, err := encoded.FormatInfo()
+	require.NoError(t, err)
+	for mask, penalty := range penalties {
+		require.GreaterOrEqual(t, penalty, penalties[info.Mask], "mask %d", mask)
+	}
+	require.Equal(t, encoded.MaskPenalty(), penalties[info.Mask])
+
+	// Every mask pattern of a decoded symbol is scored the same way.
+	qr := decodeFile(t, "qrcode-mixed.png")
+	penalties, err = qr.MaskPenalties()
+	require.NoError(t, err)
+	info, err = qr.FormatInfo()
+	require.NoError(t, err)
+	require.Equal(t, qr.MaskPenalty(), penalties[info.Mask])
+}
+
+func TestOptimalSegments(t *testing.T) {
+	segmentBits := func(segments []Segment, version int) int {
+		_, bits, ok, err := encodeSegments(segments, version)
+		require.NoError(t, err)
+		require.True(t, ok)
+		return len(bits)
+	}
+	// bruteForce tries every split of content into every mode.
+	var bruteForce func(content string, version int) int
+	bruteForce = func(content string, version int) int {
+		if content == "" {
+			return 0
+		}
+		best := math.MaxInt
+		for n := 1; n <= len(content); n++ {
+			for _, mode := range []int{ModeNumeric, ModeAlphanumeric, ModeByte} {
+				segment := []Segment{{Mode: mode, Data: []byte(content[:n])}}
+				if _, bits, _, err := encodeSegments(segment, version); err == nil {
+					best = min(best, len(bits)+bruteForce(content[n:], version))
+				}
+			}
+		}
+		return best
+	}
+	for _, content := range []string{"A1", "ab12", "123A4567", "A12345B", "0A1B2C3", "a1234B5c", "12.34%x"} {
+		for _, version := range []int{1, 10, 27} {
+			segments, err := OptimalSegments([]byte(content), version)
+			require.NoError(t, err)
+			require.Equal(t, bruteForce(content, version), segmentBits(segments, version), "%s in version %d", content, version)
+		}
+	}
+
+	// The digits of the URL save a version at level M.
+	segments, err := OptimalSegments([]byte("HTTPS://EXAMPLE.COM/P/00012345678901234567"), 2)
+	require.NoError(t, err)
+	require.Equal(t, []Segment{
+		{Mode: ModeAlphanumeric, Data: []byte("HTTPS://EXAMPLE.COM/P/"), ECI: -1},
+		{Mode: ModeNumeric, Data: []byte("00012345678901234567"), ECI: -1},
+	}, segments)
+	require.Equal(t, 215, segmentBits(segments, 2))
+
+	// Shift JIS text uses Kanji mode, other text never does.
+	sjis, err := japanese.ShiftJIS.NewEncoder().Bytes([]byte("漢字とカナ: 123"))
+	require.NoError(t, err)
+	segments, err = OptimalSegments(sjis, 1)
+	require.NoError(t, err)
+	require.Equal(t, ModeKanji, segments[0].Mode)
+	encoded, err := Encode(sjis, Medium)
+	require.NoError(t, err)
+	require.Equal(t, "漢字とカナ: 123", decodeEncoded(t, encoded).Content)
+
+	segments, err = OptimalSegments([]byte("漢字とカナ"), 1)
+	require.NoError(t, err)
+	require.Equal(t, []Segment{{Mode: ModeByte, Data: []byte("漢字とカナ"), ECI: -1}}, segments)
+}
+
+func TestRender(t *testing.T) {
+	encoded, err := Encode([]byte("https://github.com/tuotoo/qrcode"), Medium)
+	require.NoError(t, err)
+
+	img := encoded.Image(nil)
+	require.Equal(t, (len(encoded.Points)+8)*4, img.Bounds().Dx())
+	// The quiet zone ends where the top left finder pattern starts.
+	r, g, b, _ := img.At(15, 15).RGBA()
+	require.Equal(t, []uint32{0xffff, 0xffff, 0xffff}, []uint32{r, g, b})
+	r, g, b, _ = img.At(16, 16).RGBA()
+	require.Equal(t, []uint32{0, 0, 0}, []uint32{r, g, b})
+	qr, err := DecodeImage(img)
+	require.NoError(t, err)
+	require.Equal(t, encoded.Content, qr.Content)
+	require.Equal(t, encoded.Points, qr.Points)
+
+	opts := &RenderOptions{
+		ModuleSize: 3,
+		QuietZone:  2,
+		Foreground: color.RGBA{0x00, 0x00, 0x80, 0xff},
+		Background: color.RGBA{0xff, 0xff, 0xe0, 0xff},
+	}
+	img = encoded.Image(opts)
+	require.Equal(t, (len(encoded.Points)+4)*3, img.Bounds().Dx())
+	require.Equal(t, opts.Background, img.At(0, 0))
+	require.Equal(t, opts.Foreground, img.At(6, 6))
+
+	var buf bytes.Buffer
+	require.NoError(t, encoded.WritePNG(&buf, opts))
+	qr, err = Decode(&buf)
+	require.NoError(t, err)
+	require.Equal(t, encoded.Content, qr.Content)
+
+	buf.Reset()
+	require.NoError(t, encoded.WriteJPEG(&buf, &RenderOptions{ModuleSize: 8, QuietZone: 4}, &jpeg.Options{Quality: 75}))
+	qr, err = Decode(&buf)
+	require.NoError(t, err)
+	require.Equal(t, encoded.Content, qr.Content)
+}
+
+func TestModuleRects(t *testing.T) {
+	encoded, err := Encode([]byte("https://github.com/tuotoo/qrcode"), Medium)
+	require.NoError(t, err)
+	covered := make(map[image.Point]int)
+	dark := 0
+	rects := encoded.moduleRects()
+	for _, r := range rects {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				covered[image.Pt(x, y)]++
+			}
+		}
+	}
+	for y, line := range encoded.Points {
+		for x, value := range line {
+			if value {
+				dark++
+				require.Equal(t, 1, covered[image.Pt(x, y)], "module %d,%d", x, y)
+			} else {
+				require.Zero(t, covered[image.Pt(x, y)], "module %d,%d", x, y)
+			}
+		}
+	}
+	require.Less(t, len(rects), dark/2)
+}
+
+func TestWriteSVG(t *testing.T) {
+	encoded, err := Encode([]byte("HELLO WORLD"), Medium)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, encoded.WriteSVG(&buf, &VectorOptions{
+		ModuleSize: 1,
+		QuietZone:  4,
+		Background: color.Transparent,
+		Text:       "HELLO <WORLD>",
+		FontSize:   2,
+	}))
+	var svg struct {
+		Width   string     `xml:"width,attr"`
+		Height  string     `xml:"height,attr"`
+		ViewBox string     `xml:"viewBox,attr"`
+		Rect    []struct{} `xml:"rect"`
+		Path    []struct {
+			D string `xml:"d,attr"`
+		} `xml:"path"`
+		Text string `xml:"text"`
+	}
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &svg))
+	require.Equal(t, "29mm", svg.Width)
+	require.Equal(t, "32mm", svg.Height)
+	require.Equal(t, "0 0 29 32", svg.ViewBox)
+	require.Empty(t, svg.Rect)
+	require.Len(t, svg.Path, 1)
+	require.Equal(t, "M4 4h7v1h-7z", svg.Path[0].D[:len("M4 4h7v1h-7z")])
+	require.Equal(t, "HELLO <WORLD>", svg.Text)
+}
+
+func TestWritePDF(t *testing.T) {
+	encoded, err := Encode([]byte("HELLO WORLD"), Medium)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, encoded.WritePDF(&buf, &VectorOptions{ModuleSize: 25.4 / 72, QuietZone: 4, Text: "(1) 10€", FontSize: 6 * 25.4 / 72}))
+	pdf := buf.String()
+	require.True(t, strings.HasPrefix(pdf, "%PDF-1.4\n"))
+	require.True(t, strings.HasSuffix(pdf, "%%EOF\n"))
+	require.Contains(t, pdf, "/MediaBox [0 0 29 38]")
+	require.Contains(t, pdf, "4 33 7 1 re\n")
+	require.Contains(t, pdf, "(\\(1\\) 10?) Tj")
+
+	// The cross-reference table points at every object.
+	xref := strings.Index(pdf, "xref\n")
+	require.Contains(t, pdf, fmt.Sprintf("startxref\n%d\n", xref))
+	for i, line := range strings.Split(pdf[xref:], "\n")[3:8] {
+		offset, err := strconv.Atoi(line[:10])
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(pdf[offset:], fmt.Sprintf("%d 0 obj\n", i+1)), line)
+	}
+}
+
+func TestTerminal(t *testing.T) {
+	encoded, err := Encode([]byte("HELLO WORLD"), Medium)
+	require.NoError(t, err)
+	for _, opts := range []*TerminalOptions{
+		nil,
+		{QuietZone: 0},
+		{QuietZone: 1, Invert: true},
+		{QuietZone: 4, Color: true},
+		{QuietZone: 3, Invert: true, Color: true},
+	} {
+		var buf bytes.Buffer
+		require.NoError(t, encoded.WriteTerminal(&buf, opts))
+		invert := opts != nil && opts.Invert
+		qr, err := DecodeTerminal(buf.String(), invert)
+		require.NoError(t, err, buf.String())
+		require.Equal(t, encoded.Points, qr.Points)
+		require.Equal(t, "HELLO WORLD", qr.Content)
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, encoded.WriteTerminal(&buf, &TerminalOptions{QuietZone: 1, Color: true}))
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 12)
+	// The quiet zone above the top row of the finder patterns.
+	require.True(t, strings.HasPrefix(lines[0], ansiDarkOnLight+" ▄▄▄▄▄▄▄ "), lines[0])
+	require.True(t, strings.HasSuffix(lines[0], " ▄▄▄▄▄▄▄ "+ansiReset), lines[0])
+	require.True(t, strings.HasPrefix(lines[1], ansiDarkOnLight+" █ ▄▄▄ █ "), lines[1])
+
+	// One character per module, as fixtures are written by hand.
+	var text strings.Builder
+	for _, line := range encoded.Points {
+		text.WriteString("..")
+		for _, dark := range line {
+			if dark {
+				text.WriteByte('#')
+			} else {
+				text.WriteByte('.')
+			}
+		}
+		text.WriteString("\n")
+	}
+	qr, err := DecodeTerminal(text.String(), false)
+	require.NoError(t, err)
+	require.Equal(t, "HELLO WORLD", qr.Content)
+
+	_, err = ParseTerminal("   \n   \n", false)
+	require.Error(t, err)
+}
+
+func TestTerminalLightEdge(t *testing.T) {
+	// An M4 symbol whose right column is light, timing pattern included;
+	// error correction recovers the data modules.
+	micro, err := EncodeMicro([]byte("EDGE"), High)
+	require.NoError(t, err)
+	require.Equal(t, 4, micro.MicroVersion())
+	micro = &Matrix{Points: micro.Points.Copy()}
+	for y := range micro.Points {
+		micro.Points[y][len(micro.Points)-1] = false
+	}
+
+	// An rMQR symbol whose right column and bottom row are light; they only
+	// hold function patterns.
+	version := rmqrVersionOfSize(11, 27)
+	rmqr := rmqrSymbol(t, version, Medium, rmqrData(t, version, Medium, []Segment{{Mode: ModeAlphanumeric, Data: []byte("EDGE")}}))
+	for y := range rmqr.Points {
+		rmqr.Points[y][version.Width-1] = false
+	}
+	for x := range rmqr.Points[0] {
+		rmqr.Points[version.Height-1][x] = false
+	}
+
+	for _, symbol := range []*Matrix{micro, rmqr} {
+		for _, opts := range []*TerminalOptions{nil, {QuietZone: 0, Invert: true}} {
+			var buf bytes.Buffer
+			require.NoError(t, symbol.WriteTerminal(&buf, opts))
+			qr, err := DecodeTerminal(buf.String(), opts != nil && opts.Invert)
+			require.NoError(t, err, buf.String())
+			require.Equal(t, symbol.Points, qr.Points)
+			require.Equal(t, "EDGE", qr.Content)
+		}
+	}
+}
+
+func TestEncodeStructuredAppend(t *testing.T) {
+	join := func(symbols []*Matrix) *DataStream {
+		var decoded []*Matrix
+		for _, symbol := range symbols {
+			decoded = append(decoded, decodeEncoded(t, symbol))
+		}
+		joined, err := JoinStructuredAppend(decoded)
+		require.NoError(t, err)
+		return joined
+	}
+
+	// Beyond the 2953 bytes of version 40-L.
+	manifest := []byte(strings.Repeat("PALLET 0042; carton 17/20; weight 12.5kg\n", 100))
+	symbols, err := EncodeStructuredAppend(manifest, Low, 40)
+	require.NoError(t, err)
+	require.Len(t, symbols, 2)
+	require.Equal(t, 40, symbols[0].Version())
+	for i, symbol := range symbols {
+		require.Equal(t, i, symbol.StructuredAppend.Index)
+		require.Equal(t, 2, symbol.StructuredAppend.Total)
+		require.Equal(t, symbols[0].StructuredAppend.Parity, symbol.StructuredAppend.Parity)
+	}
+	require.Equal(t, string(manifest), string(join(symbols).Content))
+
+	// Parts are cut between characters.
+	text := []byte(strings.Repeat("QR コード 1234567890 ", 8))
+	symbols, err = EncodeStructuredAppend(text, Medium, 3)
+	require.NoError(t, err)
+	require.Greater(t, len(symbols), 2)
+	for _, symbol := range symbols {
+		require.LessOrEqual(t, symbol.Version(), 3)
+		require.True(t, utf8.ValidString(symbol.Content), symbol.Content)
+	}
+	require.Equal(t, string(text), string(join(symbols).Content))
+
+	symbols, err = EncodeStructuredAppend([]byte("HELLO"), Medium, 40)
+	require.NoError(t, err)
+	require.Len(t, symbols, 1)
+	require.Equal(t, &StructuredAppend{Index: 0, Total: 1, Parity: 'H' ^ 'E' ^ 'L' ^ 'L' ^ 'O'}, symbols[0].StructuredAppend)
+	require.Equal(t, "HELLO", string(join(symbols).Content))
+
+	_, err = EncodeStructuredAppend(make([]byte, 300), Low, 1)
+	require.Error(t, err)
+	_, err = EncodeStructuredAppend([]byte("HELLO"), Low, 41)
+	require.Error(t, err)
+}
+
+// annexIMicroSymbol is the Micro QR symbol of the encoding example of ISO/IEC
+// 18004 Annex I, "01234567" in M2-L with mask 01. It was drawn by a separate
+// implementation written from the standard, which shares no code with this
+// package.
+var annexIMicroSymbol = []string{
+	"#######.#.#.#",
+	"#.....#.###.#",
+	"#.###.#..##.#",
+	"#.###.#..####",
+	"#.###.#.###..",
+	"#.....#.#...#",
+	"#######..####",
+	".........##..",
+	"##.#....#...#",
+	".##.#.#.#.#.#",
+	"###..#######.",
+	"...#.#....##.",
+	"###.#..##.###",
+}
+
+// goldenPoints returns the modules of a symbol written with '#' for dark
+// modules.
+func goldenPoints(rows []string) PointsMatrix {
+	points := make(PointsMatrix, len(rows))
+	for y, row := range rows {
+		for _, c := range row {
+			points[y] = append(points[y], c == '#')
+		}
+	}
+	return points
+}
+
+// microSymbol draws a Micro QR symbol around its data codewords, the last of
+// M1 and M3 holding 4 bits in its high nibble.
+func microSymbol(t *testing.T, version int, level RecoveryLevel, mask int, data []byte) *Matrix {
+	t.Helper()
+	symbol := -1
+	for i, v := range MicroVersions {
+		if v.Version == version && v.Level == level {
+			symbol = i
+		}
+	}
+	require.GreaterOrEqual(t, symbol, 0)
+	block := MicroVersions[symbol].Block[0]
+	require.Len(t, data, block.NumDataCodewords)
+
+	width := version*2 + 9
+	mx := &Matrix{Points: make(PointsMatrix, width)}
+	for y := range mx.Points {
+		mx.Points[y] = make([]bool, width)
+	}
+	for y := 0; y < 7; y++ {
+		for x := 0; x < 7; x++ {
+			ring := x == 0 || y == 0 || x == 6 || y == 6
+			centre := x >= 2 && x <= 4 && y >= 2 && y <= 4
+			mx.Points[y][x] = ring || centre
+		}
+	}
+	for i := 8; i < width; i += 2 {
+		mx.Points[0][i] = true
+		mx.Points[i][0] = true
+	}
+	format := microFormatBits(symbol<<2 | mask)
+	for i, pos := range microFormatInfoPositions() {
+		mx.Points[pos.Y][pos.X] = format>>(14-i)&1 == 1
+	}
+
+	dataBits := microDataBits(&MicroVersions[symbol])
+	bits := append(Byte2Bool(data)[:dataBits], Byte2Bool(reedsolomon.Encode(data, block.NumCodewords-block.NumDataCodewords))...)
+	maskFunc := MaskFunc(microMasks[mask])
+	positions := DataPositions(mx.DataArea())
+	require.Len(t, positions, len(bits))
+	for i, pos := range positions {
+		mx.Points[pos.Y][pos.X] = bits[i] != maskFunc(pos.X, pos.Y)
+	}
+	return mx
+}
+
+func TestDecodeMicro(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+		level   RecoveryLevel
+		data    []byte
+		content string
+		modes   []int
+	}{
+		// The numeric example of ISO/IEC 18004 Annex I.
+		{"M2-L", 2, Low, []byte{0x40, 0x18, 0xac, 0xc3, 0x00}, "01234567", []int{ModeNumeric}},
+		{"M1", 1, Low, []byte{0xa3, 0xda, 0xd0}, "12345", []int{ModeNumeric}},
+		{"M3-L Kanji", 3, Low, []byte{0xcb, 0x67, 0xc0, 0x00, 0xec, 0x11, 0xec, 0x11, 0xec, 0x11, 0x00}, "点", []int{ModeKanji}},
+		{"M4-L byte", 4, Low, []byte{0x43, 0x48, 0x69, 0x21, 0x00, 0x00, 0xec, 0x11, 0xec, 0x11, 0xec, 0x11, 0xec, 0x11, 0xec, 0x11}, "Hi!", []int{ModeByte}},
+	}
+	for _, tt := range tests {
+		for mask := 0; mask < 4; mask++ {
+			symbol := microSymbol(t, tt.version, tt.level, mask, tt.data)
+			qr := decodeEncoded(t, symbol)
+			require.Equal(t, tt.content, qr.Content, tt.name)
+			require.True(t, qr.IsMicro(), tt.name)
+			require.Equal(t, tt.version, qr.MicroVersion(), tt.name)
+			info, err := qr.FormatInfo()
+			require.NoError(t, err, tt.name)
+			require.Equal(t, int(tt.level), info.ErrorCorrectionLevel, tt.name)
+			require.Equal(t, mask, info.Mask, tt.name)
+			var modes []int
+			for _, segment := range qr.Segments {
+				modes = append(modes, segment.Mode)
+			}
+			require.Equal(t, tt.modes, modes, tt.name)
+			require.True(t, qr.Audit.Clean(), qr.Audit.String())
+
+			var text bytes.Buffer
+			require.NoError(t, symbol.WriteTerminal(&text, nil))
+			qr, err = DecodeTerminal(text.String(), false)
+			require.NoError(t, err, tt.name)
+			require.Equal(t, tt.content, qr.Content, tt.name)
+
+			qr, err = DecodeImage(symbol.Image(&RenderOptions{ModuleSize: 6, QuietZone: 2}))
+			require.NoError(t, err, tt.name)
+			require.Equal(t, tt.content, qr.Content, tt.name)
+		}
+	}
+
+	// The symbol of the standard, which microSymbol draws alike.
+	golden := &Matrix{Points: goldenPoints(annexIMicroSymbol)}
+	require.Equal(t, golden.Points, microSymbol(t, 2, Low, 1, tests[0].data).Points)
+	qr := decodeEncoded(t, golden)
+	require.Equal(t, "01234567", qr.Content)
+	require.Equal(t, 2, qr.MicroVersion())
+	info, err := qr.FormatInfo()
+	require.NoError(t, err)
+	require.Equal(t, int(Low), info.ErrorCorrectionLevel)
+	require.Equal(t, 1, info.Mask)
+	require.Equal(t, []byte{0x40, 0x18, 0xac, 0xc3, 0x00}, Bool2Byte(qr.Data[:40]))
+	qr, err = DecodeImage(golden.Image(&RenderOptions{ModuleSize: 4, QuietZone: 2}))
+	require.NoError(t, err)
+	require.Equal(t, "01234567", qr.Content)
+
+	// M2-L corrects one error, M1 only detects it.
+	symbol := microSymbol(t, 2, Low, 0, tests[0].data)
+	symbol.Points[12][12] = !symbol.Points[12][12]
+	qr = decodeEncoded(t, symbol)
+	require.Equal(t, "01234567", qr.Content)
+	require.Equal(t, 1, qr.ErrorCorrection.Corrected())
+	symbol = microSymbol(t, 1, Low, 0, tests[1].data)
+	symbol.Points[10][10] = !symbol.Points[10][10]
+	require.Error(t, new(Decoder).decodeMatrix(&Matrix{Points: symbol.Points}))
+
+	// M4-L corrects three errors.
+	symbol = microSymbol(t, 4, Low, 0, tests[3].data)
+	positions := DataPositions(symbol.DataArea())
+	for _, codeword := range []int{0, 9, 20} {
+		pos := positions[codeword*8]
+		symbol.Points[pos.Y][pos.X] = !symbol.Points[pos.Y][pos.X]
+	}
+	qr = decodeEncoded(t, symbol)
+	require.Equal(t, "Hi!", qr.Content)
+	require.Equal(t, 3, qr.ErrorCorrection.Corrected())
+	require.Equal(t, 3, qr.ErrorCorrection.Blocks[0].Capacity)
+	require.Equal(t, 0, qr.ErrorCorrection.Blocks[0].Margin)
+
+	// Format information of M3 in a symbol of the width of M2.
+	symbol = microSymbol(t, 2, Low, 0, tests[0].data)
+	format := microFormatBits(3 << 2)
+	for i, pos := range microFormatInfoPositions() {
+		symbol.Points[pos.Y][pos.X] = format>>(14-i)&1 == 1
+	}
+	require.Error(t, new(Decoder).decodeMatrix(&Matrix{Points: symbol.Points}))
+
+	stream, err := ParseMicroDataStream(Byte2Bool([]byte{0x40, 0x18, 0xac, 0xc3, 0x00}), 2)
+	require.NoError(t, err)
+	require.Equal(t, "01234567", string(stream.Content))
+	_, err = ParseMicroDataStream(nil, 5)
+	require.Error(t, err)
+}
+
+func TestEncodeMicro(t *testing.T) {
+	kanji, err := japanese.ShiftJIS.NewEncoder().String("点")
+	require.NoError(t, err)
+	tests := []struct {
+		content string
+		level   RecoveryLevel
+		version int
+		modes   []int
+	}{
+		{"12345", Low, 1, []int{ModeNumeric}},
+		{"123456", Low, 2, []int{ModeNumeric}},
+		{"01234567", Medium, 2, []int{ModeNumeric}},
+		{"HELLO", Low, 2, []int{ModeAlphanumeric}},
+		{"Hi!", Low, 3, []int{ModeByte}},
+		{kanji, Low, 3, []int{ModeKanji}},
+		{"abc", High, 4, []int{ModeByte}},
+		{"PCB-REV-C 0123456789012345", Low, 4, []int{ModeAlphanumeric, ModeNumeric}},
+	}
+	for _, tt := range tests {
+		encoded, err := EncodeMicro([]byte(tt.content), tt.level)
+		require.NoError(t, err, tt.content)
+		require.Equal(t, tt.version, encoded.MicroVersion(), tt.content)
+		var modes []int
+		for _, segment := range encoded.Segments {
+			modes = append(modes, segment.Mode)
+		}
+		require.Equal(t, tt.modes, modes, tt.content)
+
+		qr := decodeEncoded(t, encoded)
+		require.Equal(t, tt.content, string(qr.Raw), tt.content)
+		require.Equal(t, encoded.Data, qr.Data, tt.content)
+		require.True(t, qr.Audit.Clean(), qr.Audit.String())
+		info, err := qr.FormatInfo()
+		require.NoError(t, err)
+		require.Equal(t, int(tt.level), info.ErrorCorrectionLevel, tt.content)
+
+		scores, err := encoded.MicroMaskScores()
+		require.NoError(t, err)
+		for _, score := range scores {
+			require.LessOrEqual(t, score, scores[info.Mask], tt.content)
+		}
+
+		qr, err = DecodeImage(encoded.Image(&RenderOptions{ModuleSize: 5, QuietZone: 2}))
+		require.NoError(t, err, tt.content)
+		require.Equal(t, tt.content, string(qr.Raw), tt.content)
+	}
+
+	// The numeric example of ISO/IEC 18004 Annex I.
+	encoded, err := EncodeMicro([]byte("01234567"), Low)
+	require.NoError(t, err)
+	data := []byte{0x40, 0x18, 0xac, 0xc3, 0x00}
+	require.Equal(t, Byte2Bool(data), encoded.Data)
+	require.Equal(t, goldenPoints(annexIMicroSymbol), encoded.Points)
+	info, err := encoded.FormatInfo()
+	require.NoError(t, err)
+	require.Equal(t, 1, info.Mask)
+
+	// Written as PNG and read back through Decode.
+	var img bytes.Buffer
+	require.NoError(t, encoded.WritePNG(&img, &RenderOptions{ModuleSize: 4, QuietZone: 2}))
+	qr, err := Decode(&img)
+	require.NoError(t, err)
+	require.Equal(t, "01234567", qr.Content)
+	require.Equal(t, 2, qr.MicroVersion())
+	require.Equal(t, encoded.Points, qr.Points)
+
+	// The last data codeword of M1 has 4 bits.
+	encoded, err = EncodeMicro([]byte("12345"), Low)
+	require.NoError(t, err)
+	require.Equal(t, Byte2Bool([]byte{0xa3, 0xda, 0xd0})[:20], encoded.Data)
+
+	_, err = EncodeMicro([]byte("1"), Highest)
+	require.Error(t, err)
+	_, err = EncodeMicro([]byte(strings.Repeat("1", 36)), Low)
+	require.Error(t, err)
+	_, err = EncodeMicroSegments([]Segment{{Mode: ModeHanzi, Data: []byte{0xb5, 0xe3}}}, Low)
+	require.Error(t, err)
+	encoded, err = EncodeMicroSegments([]Segment{{Mode: ModeByte, Data: []byte("1")}}, Low)
+	require.NoError(t, err)
+	require.Equal(t, 3, encoded.MicroVersion())
+}
+
+func TestMicroMaskScore(t *testing.T) {
+	mx := &Matrix{Points: make(PointsMatrix, 11)}
+	for y := range mx.Points {
+		mx.Points[y] = make([]bool, 11)
+		// The right edge below the timing pattern.
+		mx.Points[y][10] = y > 0
+	}
+	mx.Points[10][0] = true // timing pattern
+	mx.Points[10][3] = true
+	mx.Points[10][5] = true
+	// 2 dark modules in the bottom edge besides its corner.
+	require.Equal(t, 3*16+10, mx.MicroMaskScore())
+
+	_, err := mx.MicroMaskScores()
+	require.Error(t, err)
+}
+
+// rmqrSymbol draws an rMQR symbol of version at level around its data
+// codewords.
+func rmqrSymbol(t testing.TB, version *RMQRVersion, level RecoveryLevel, data []byte) *Matrix {
+	t.Helper()
+	height, width := version.Height, version.Width
+	mx := &Matrix{Points: make(PointsMatrix, height)}
+	for y := range mx.Points {
+		mx.Points[y] = make([]bool, width)
+	}
+	set := func(x, y int, dark bool) {
+		if x >= 0 && x < width && y >= 0 && y < height {
+			mx.Points[y][x] = dark
+		}
+	}
+	for x := 0; x < width; x++ {
+		set(x, 0, x%2 == 0)
+		set(x, height-1, x%2 == 0)
+	}
+	for _, x := range append([]int{0, width - 1}, version.AlignmentColumns...) {
+		for y := 0; y < height; y++ {
+			set(x, y, y%2 == 0)
+		}
+	}
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			ring := x == 0 || y == 0 || x == 6 || y == 6
+			centre := x >= 2 && x <= 4 && y >= 2 && y <= 4
+			set(x, y, x < 7 && y < 7 && (ring || centre))
+		}
+	}
+	for _, cx := range version.AlignmentColumns {
+		for y := 0; y < 3; y++ {
+			for x := -1; x <= 1; x++ {
+				set(cx+x, y, x != 0 || y != 1)
+				set(cx+x, height-1-y, x != 0 || y != 1)
+			}
+		}
+	}
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 5; x++ {
+			ring := x == 0 || y == 0 || x == 4 || y == 4
+			set(width-5+x, height-5+y, ring || x == 2 && y == 2)
+		}
+	}
+	set(width-2, 0, true)
+	set(width-1, 0, true)
+	set(width-1, 1, true)
+	set(width-2, 1, false)
+	for x := 0; x < 3; x++ {
+		set(x, height-1, true)
+	}
+	if height >= 11 {
+		set(0, height-2, true)
+		set(1, height-2, false)
+	}
+
+	format := version.Version - 1
+	if level == Highest {
+		format |= 1 << 5
+	}
+	fi1, fi2 := rmqrFormatInfoPositions(height, width)
+	for i := range fi1 {
+		set(fi1[i].X, fi1[i].Y, (rmqrFormatBits(format)^rmqrFormatMask)>>(17-i)&1 == 1)
+		set(fi2[i].X, fi2[i].Y, (rmqrFormatBits(format)^rmqrSubFormatMask)>>(17-i)&1 == 1)
+	}
+
+	bits := Byte2Bool(interleaveBlocks(version.qrCodeVersion(level), data))
+	maskFunc := MaskFunc(4)
+	positions := DataPositions(mx.DataArea())
+	require.Len(t, positions, len(bits)+version.NumRemainderBits)
+	for i, pos := range positions {
+		set(pos.X, pos.Y, (i < len(bits) && bits[i]) != maskFunc(pos.X, pos.Y))
+	}
+	return mx
+}
+
+// rmqrData encodes segments into the data codewords of version at level.
+func rmqrData(t testing.TB, version *RMQRVersion, level RecoveryLevel, segments []Segment) []byte {
+	t.Helper()
+	format, err := rmqrStreamFormat(version.Version)
+	require.NoError(t, err)
+	_, bits, ok, err := encodeStreamSegments(segments, format)
+	require.NoError(t, err)
+	require.True(t, ok)
+	capacity := version.qrCodeVersion(level).numDataCodewords() * 8
+	require.LessOrEqual(t, len(bits), capacity)
+	return padDataCodewords(bits, capacity, format.terminatorBits)
+}
+
+func TestRMQRVersions(t *testing.T) {
+	require.Len(t, RMQRVersions, 32)
+	for i := range RMQRVersions {
+		version := &RMQRVersions[i]
+		require.Equal(t, i+1, version.Version)
+		mx := &Matrix{Points: make(PointsMatrix, version.Height)}
+		for y := range mx.Points {
+			mx.Points[y] = make([]bool, version.Width)
+		}
+		require.True(t, mx.IsRMQR(), version.Name())
+		require.False(t, mx.IsMicro(), version.Name())
+		modules := len(DataPositions(mx.DataArea()))
+		for _, level := range []RecoveryLevel{Medium, Highest} {
+			numCodewords := 0
+			for _, block := range version.qrCodeVersion(level).Block {
+				numCodewords += block.NumBlocks * block.NumCodewords
+				// All blocks have as many error correction codewords.
+				require.Equal(t, version.qrCodeVersion(level).Block[0].NumCodewords-version.qrCodeVersion(level).Block[0].NumDataCodewords,
+					block.NumCodewords-block.NumDataCodewords, version.Name())
+			}
+			require.Equal(t, modules, numCodewords*8+version.NumRemainderBits, version.Name())
+		}
+		require.Nil(t, version.qrCodeVersion(Low))
+	}
+}
+
+func TestDecodeRMQR(t *testing.T) {
+	// 3-bit mode indicator and 4-bit count of R7x43.
+	require.Equal(t, []byte{0x2a, 0x3d, 0xad, 0x00, 0xec, 0x11},
+		rmqrData(t, &RMQRVersions[0], Medium, []Segment{{Mode: ModeNumeric, Data: []byte("12345")}}))
+	// Module for module the same as the examples drawn independently.
+	for _, tt := range []struct {
+		in      string
+		version int
+		level   RecoveryLevel
+		segment Segment
+	}{
+		{"rmqr-r7x43.png", 1, Medium, Segment{Mode: ModeNumeric, Data: []byte("12345")}},
+		{"rmqr-r17x139.png", 32, Highest, Segment{Mode: ModeByte, Data: []byte("ISO/IEC 23941 rMQR R17x139 cable label")}},
+	} {
+		f, err := os.Open(filepath.Join("example", tt.in))
+		require.NoError(t, err)
+		golden, err := Decode(f)
+		f.Close()
+		require.NoError(t, err, tt.in)
+		version := &RMQRVersions[tt.version-1]
+		require.Equal(t, version, golden.RMQRVersion(), tt.in)
+		require.Equal(t, golden.Points,
+			rmqrSymbol(t, version, tt.level, rmqrData(t, version, tt.level, []Segment{tt.segment})).Points, tt.in)
+	}
+
+
+	kanji, err := japanese.ShiftJIS.NewEncoder().String("点検")
+	require.NoError(t, err)
+	tests := []struct {
+		version  int
+		level    RecoveryLevel
+		segments []Segment
+		content  string
+	}{
+		{1, Medium, []Segment{{Mode: ModeNumeric, Data: []byte("12345")}}, "12345"},
+		{1, Highest, []Segment{{Mode: ModeAlphanumeric, Data: []byte("AB")}}, "AB"},
+		{11, Medium, []Segment{{Mode: ModeByte, Data: []byte("cable")}}, "cable"},
+		{21, Highest, []Segment{{Mode: ModeAlphanumeric, Data: []byte("LOT ")}, {Mode: ModeNumeric, Data: []byte("2024061500017")}}, "LOT 2024061500017"},
+		{22, Medium, []Segment{{Mode: ModeKanji, Data: []byte(kanji)}}, "点検"},
+		{32, Medium, []Segment{{Mode: ModeByte, Data: []byte(strings.Repeat("label ", 25))}}, strings.Repeat("label ", 25)},
+	}
+	for _, tt := range tests {
+		version := &RMQRVersions[tt.version-1]
+		name := version.Name()
+		symbol := rmqrSymbol(t, version, tt.level, rmqrData(t, version, tt.level, tt.segments))
+		qr := decodeEncoded(t, symbol)
+		require.Equal(t, tt.content, qr.Content, name)
+		require.Equal(t, version, qr.RMQRVersion(), name)
+		require.True(t, qr.Audit.Clean(), qr.Audit.String())
+		info, err := qr.FormatInfo()
+		require.NoError(t, err)
+		require.Equal(t, int(tt.level), info.ErrorCorrectionLevel, name)
+		require.Equal(t, tt.version, info.RMQRVersion, name)
+
+		var text bytes.Buffer
+		require.NoError(t, symbol.WriteTerminal(&text, nil))
+		qr, err = DecodeTerminal(text.String(), false)
+		require.NoError(t, err, name)
+		require.Equal(t, tt.content, qr.Content, name)
+	}
+
+	version := &RMQRVersions[16] // R13x27
+	data := rmqrData(t, version, Medium, []Segment{{Mode: ModeAlphanumeric, Data: []byte("RMQR")}})
+	symbol := rmqrSymbol(t, version, Medium, data)
+
+	// Rendered with a quiet zone of 2 modules.
+	qr, err := DecodeImage(symbol.Image(&RenderOptions{ModuleSize: 6, QuietZone: 2}))
+	require.NoError(t, err)
+	require.Equal(t, "RMQR", qr.Content)
+	require.Equal(t, "R13x27", qr.RMQRVersion().Name())
+
+	// The artwork is as wide as the symbol, not as high.
+	var svg bytes.Buffer
+	require.NoError(t, symbol.WriteSVG(&svg, nil))
+	require.Contains(t, svg.String(), `viewBox="0 0 35 21"`)
+
+	// Errors in the data and in the first copy of the format information.
+	damaged := &Matrix{Points: symbol.Points.Copy()}
+	for _, pos := range DataPositions(damaged.DataArea())[:8] {
+		damaged.Points[pos.Y][pos.X] = !damaged.Points[pos.Y][pos.X]
+	}
+	fi1, _ := rmqrFormatInfoPositions(version.Height, version.Width)
+	for _, pos := range fi1[:6] {
+		damaged.Points[pos.Y][pos.X] = !damaged.Points[pos.Y][pos.X]
+	}
+	qr = decodeEncoded(t, damaged)
+	require.Equal(t, "RMQR", qr.Content)
+	require.Equal(t, 1, qr.ErrorCorrection.Corrected())
+
+	// Format information of R7x43 in a symbol of R13x27.
+	damaged = &Matrix{Points: symbol.Points.Copy()}
+	_, fi2 := rmqrFormatInfoPositions(version.Height, version.Width)
+	for i := range fi1 {
+		damaged.Points[fi1[i].Y][fi1[i].X] = (rmqrFormatBits(0)^rmqrFormatMask)>>(17-i)&1 == 1
+		damaged.Points[fi2[i].Y][fi2[i].X] = (rmqrFormatBits(0)^rmqrSubFormatMask)>>(17-i)&1 == 1
+	}
+	require.Error(t, new(Decoder).decodeMatrix(damaged))
+
+	stream, err := ParseRMQRDataStream(Byte2Bool(data), version.Version)
+	require.NoError(t, err)
+	require.Equal(t, "RMQR", string(stream.Content))
+	_, err = ParseRMQRDataStream(nil, 33)
+	require.Error(t, err)
+}
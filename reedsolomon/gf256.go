@@ -0,0 +1,108 @@
+package reedsolomon
+
+// Primitive is the field polynomial x^8 + x^4 + x^3 + x^2 + 1 used by QR
+// codes; the field generator is α = 2.
+const Primitive = 0x11d
+
+var expTable, logTable = func() ([512]byte, [256]byte) {
+	var exp [512]byte
+	var log [256]byte
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(x)
+		log[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= Primitive
+		}
+	}
+	for i := 255; i < 512; i++ {
+		exp[i] = exp[i-255]
+	}
+	return exp, log
+}()
+
+// Exp returns α^e.
+func Exp(e int) byte {
+	e %= 255
+	if e < 0 {
+		e += 255
+	}
+	return expTable[e]
+}
+
+// Log returns the discrete logarithm of a, which must not be zero.
+func Log(a byte) int {
+	return int(logTable[a])
+}
+
+// Mul multiplies two field elements.
+func Mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+int(logTable[b])]
+}
+
+// Div divides a by b, which must not be zero.
+func Div(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+255-int(logTable[b])]
+}
+
+// Inverse returns the multiplicative inverse of a, which must not be zero.
+func Inverse(a byte) byte {
+	return expTable[255-int(logTable[a])]
+}
+
+// polyEval evaluates a polynomial stored lowest degree first.
+func polyEval(p []byte, x byte) byte {
+	var y byte
+	for i := len(p) - 1; i >= 0; i-- {
+		y = Mul(y, x) ^ p[i]
+	}
+	return y
+}
+
+// codewordEval evaluates a codeword stored highest degree first.
+func codewordEval(codeword []byte, x byte) byte {
+	var y byte
+	for _, c := range codeword {
+		y = Mul(y, x) ^ c
+	}
+	return y
+}
+
+// polyMulLinear multiplies p by (1 + a x).
+func polyMulLinear(p []byte, a byte) []byte {
+	result := make([]byte, len(p)+1)
+	for i, c := range p {
+		result[i] ^= c
+		result[i+1] ^= Mul(c, a)
+	}
+	return result
+}
+
+// polyAddScaled returns p + scale*q.
+func polyAddScaled(p, q []byte, scale byte) []byte {
+	size := len(p)
+	if len(q) > size {
+		size = len(q)
+	}
+	result := make([]byte, size)
+	copy(result, p)
+	for i, c := range q {
+		result[i] ^= Mul(c, scale)
+	}
+	return result
+}
+
+func polyScale(p []byte, scale byte) []byte {
+	result := make([]byte, len(p))
+	for i, c := range p {
+		result[i] = Mul(c, scale)
+	}
+	return result
+}
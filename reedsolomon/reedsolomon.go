@@ -0,0 +1,197 @@
+// Package reedsolomon implements the Reed-Solomon code of QR codes over
+// GF(256) with the generator polynomial Π(x - α^i), i = 0..nsym-1.
+//
+// Codewords are stored highest degree first: the data codewords followed by
+// the error correction codewords, exactly as they are read from a block.
+// Decoding handles unknown errors and erasures (errors at known positions)
+// together, so that e + 2t <= nsym for e erasures and t errors.
+package reedsolomon
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Generator returns the generator polynomial of degree nsym, highest degree
+// first. The leading coefficient is always 1.
+func Generator(nsym int) []byte {
+	g := []byte{1}
+	for i := 0; i < nsym; i++ {
+		next := make([]byte, len(g)+1)
+		for j, c := range g {
+			next[j] ^= c
+			next[j+1] ^= Mul(c, Exp(i))
+		}
+		g = next
+	}
+	return g
+}
+
+// Encode returns the nsym error correction codewords of data.
+func Encode(data []byte, nsym int) []byte {
+	g := Generator(nsym)
+	remainder := make([]byte, nsym)
+	for _, d := range data {
+		factor := d ^ remainder[0]
+		copy(remainder, remainder[1:])
+		remainder[nsym-1] = 0
+		if factor == 0 {
+			continue
+		}
+		for j := 0; j < nsym; j++ {
+			remainder[j] ^= Mul(g[j+1], factor)
+		}
+	}
+	return remainder
+}
+
+// Result describes a successful correction.
+type Result struct {
+	// Positions lists the indexes of the codewords whose value was changed.
+	Positions []int
+
+	// Erasures is the number of erasures the decoder was given and Errors
+	// the number of codewords corrected outside of them.
+	Erasures int
+	Errors   int
+}
+
+// Corrected returns the number of codewords whose value was changed.
+func (r *Result) Corrected() int {
+	return len(r.Positions)
+}
+
+// Syndromes returns the nsym syndromes of a received codeword. They are all
+// zero when the codeword is valid.
+func Syndromes(received []byte, nsym int) []byte {
+	syndromes := make([]byte, nsym)
+	for j := range syndromes {
+		syndromes[j] = codewordEval(received, Exp(j))
+	}
+	return syndromes
+}
+
+// Decode corrects the received codeword (data followed by nsym error
+// correction codewords) in place. erasures holds the indexes of codewords
+// known to be unreliable; they cost half as much correction capacity as
+// errors at unknown positions.
+func Decode(received []byte, nsym int, erasures []int) (*Result, error) {
+	n := len(received)
+	if n > 255 {
+		return nil, fmt.Errorf("codeword of %d bytes is longer than 255", n)
+	}
+	if nsym <= 0 || nsym > n {
+		return nil, fmt.Errorf("invalid number of error correction codewords: %d", nsym)
+	}
+	if len(erasures) > nsym {
+		return nil, fmt.Errorf("%d erasures exceed %d error correction codewords", len(erasures), nsym)
+	}
+
+	// Berlekamp-Massey is seeded with the erasure locator Γ(x) = Π(1 - X_k x).
+	locator := []byte{1}
+	erased := make(map[int]bool, len(erasures))
+	for _, pos := range erasures {
+		if pos < 0 || pos >= n {
+			return nil, fmt.Errorf("erasure position %d out of range", pos)
+		}
+		if erased[pos] {
+			return nil, fmt.Errorf("duplicate erasure position %d", pos)
+		}
+		erased[pos] = true
+		locator = polyMulLinear(locator, Exp(n-1-pos))
+	}
+
+	syndromes := Syndromes(received, nsym)
+	clean := true
+	for _, s := range syndromes {
+		if s != 0 {
+			clean = false
+			break
+		}
+	}
+	if clean {
+		return &Result{Erasures: len(erasures)}, nil
+	}
+
+	prev := append([]byte{}, locator...)
+	numErasures := len(erasures)
+	length := numErasures
+	for r := numErasures + 1; r <= nsym; r++ {
+		var delta byte
+		for i := 0; i < len(locator) && i < r; i++ {
+			delta ^= Mul(locator[i], syndromes[r-1-i])
+		}
+		shifted := append([]byte{0}, prev...)
+		if delta == 0 {
+			prev = shifted
+			continue
+		}
+		next := polyAddScaled(locator, shifted, delta)
+		if 2*length <= r+numErasures-1 {
+			prev = polyScale(locator, Inverse(delta))
+			length = r + numErasures - length
+		} else {
+			prev = shifted
+		}
+		locator = next
+	}
+	for len(locator) > 1 && locator[len(locator)-1] == 0 {
+		locator = locator[:len(locator)-1]
+	}
+	numErrata := len(locator) - 1
+	if 2*(numErrata-numErasures)+numErasures > nsym {
+		return nil, errors.New("too many errors to correct")
+	}
+
+	// Chien search, restricted to the positions that exist in the codeword.
+	var positions []int
+	for pos := 0; pos < n; pos++ {
+		if polyEval(locator, Exp(-(n-1-pos))) == 0 {
+			positions = append(positions, pos)
+		}
+	}
+	if len(positions) != numErrata {
+		return nil, errors.New("error locator degree does not match number of roots")
+	}
+
+	// Forney: e_k = X_k Ω(X_k⁻¹) / Λ'(X_k⁻¹) for a generator starting at α^0.
+	evaluator := make([]byte, nsym)
+	for i, s := range syndromes {
+		for j, l := range locator {
+			if i+j < nsym {
+				evaluator[i+j] ^= Mul(s, l)
+			}
+		}
+	}
+	derivative := make([]byte, len(locator))
+	for i := 1; i < len(locator); i += 2 {
+		derivative[i-1] = locator[i]
+	}
+	corrected := append([]byte{}, received...)
+	result := &Result{Erasures: numErasures}
+	for _, pos := range positions {
+		x := Exp(n - 1 - pos)
+		xInv := Inverse(x)
+		denominator := polyEval(derivative, xInv)
+		if denominator == 0 {
+			return nil, errors.New("error magnitude is undefined")
+		}
+		magnitude := Mul(x, Div(polyEval(evaluator, xInv), denominator))
+		if magnitude == 0 {
+			continue
+		}
+		corrected[pos] ^= magnitude
+		result.Positions = append(result.Positions, pos)
+		if !erased[pos] {
+			result.Errors++
+		}
+	}
+
+	for _, s := range Syndromes(corrected, nsym) {
+		if s != 0 {
+			return nil, errors.New("correction did not produce a valid codeword")
+		}
+	}
+	copy(received, corrected)
+	return result, nil
+}
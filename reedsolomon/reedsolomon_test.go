@@ -0,0 +1,125 @@
+package reedsolomon
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/maruel/rs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerator(t *testing.T) {
+	// Annex A of ISO/IEC 18004 lists the generator of degree 7 as
+	// α^0 x^7 + α^87 x^6 + α^229 x^5 + α^146 x^4 + α^149 x^3 + α^238 x^2 + α^102 x + α^21.
+	var exponents []int
+	for _, c := range Generator(7) {
+		exponents = append(exponents, Log(c))
+	}
+	require.Equal(t, []int{0, 87, 229, 146, 149, 238, 102, 21}, exponents)
+}
+
+func TestEncodeMatchesMaruel(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		data := make([]byte, 1+r.Intn(120))
+		r.Read(data)
+		nsym := 2 + r.Intn(30)
+
+		want := make([]byte, nsym)
+		rs.NewEncoder(rs.QRCodeField256, nsym).Encode(data, want)
+
+		require.Equal(t, want, Encode(data, nsym))
+	}
+}
+
+func TestDecodeMatchesMaruel(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 500; i++ {
+		data := make([]byte, 1+r.Intn(120))
+		r.Read(data)
+		nsym := 2 + r.Intn(30)
+		received := append(append([]byte{}, data...), Encode(data, nsym)...)
+
+		// Up to one error beyond the capacity so failures are compared too.
+		for _, pos := range r.Perm(len(received))[:r.Intn(nsym/2+2)] {
+			received[pos] ^= byte(1 + r.Intn(255))
+		}
+
+		want := append([]byte{}, received...)
+		wantCount, wantErr := rs.NewDecoder(rs.QRCodeField256).Decode(want[:len(data)], want[len(data):])
+
+		got := append([]byte{}, received...)
+		result, err := Decode(got, nsym, nil)
+		if wantErr != nil {
+			require.Error(t, err)
+			continue
+		}
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+		require.Equal(t, wantCount, result.Corrected())
+	}
+}
+
+func TestDecodeErrorsAndErasures(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	for i := 0; i < 2000; i++ {
+		data := make([]byte, 1+r.Intn(200))
+		r.Read(data)
+		nsym := 2 + r.Intn(min(30, 255-len(data)-1))
+		codeword := append(append([]byte{}, data...), Encode(data, nsym)...)
+
+		numErasures := r.Intn(nsym + 1)
+		numErrors := (nsym - numErasures) / 2
+		perm := r.Perm(len(codeword))
+		erasures := perm[:numErasures]
+		errorPositions := perm[numErasures:min(numErasures+numErrors, len(codeword))]
+
+		received := append([]byte{}, codeword...)
+		for _, pos := range erasures {
+			received[pos] ^= byte(r.Intn(256))
+		}
+		for _, pos := range errorPositions {
+			received[pos] ^= byte(1 + r.Intn(255))
+		}
+
+		var want []int
+		for pos := range codeword {
+			if codeword[pos] != received[pos] {
+				want = append(want, pos)
+			}
+		}
+
+		result, err := Decode(received, nsym, erasures)
+		require.NoError(t, err)
+		require.Equal(t, codeword, received)
+		require.Equal(t, len(erasures), result.Erasures)
+		require.Equal(t, len(errorPositions), result.Errors)
+		sort.Ints(want)
+		require.Equal(t, want, result.Positions)
+	}
+}
+
+func TestDecodeTooManyErrors(t *testing.T) {
+	data := []byte("reed-solomon")
+	received := append(append([]byte{}, data...), Encode(data, 10)...)
+	for i := 0; i < 6; i++ {
+		received[i*3] ^= 0xff
+	}
+	before := append([]byte{}, received...)
+
+	_, err := Decode(received, 10, nil)
+	require.Error(t, err)
+	require.Equal(t, before, received)
+}
+
+func TestDecodeInvalidArguments(t *testing.T) {
+	_, err := Decode(make([]byte, 256), 10, nil)
+	require.Error(t, err)
+	_, err = Decode(make([]byte, 10), 11, nil)
+	require.Error(t, err)
+	_, err = Decode(make([]byte, 10), 4, []int{10})
+	require.Error(t, err)
+	_, err = Decode(make([]byte, 10), 4, []int{1, 1})
+	require.Error(t, err)
+}
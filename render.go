@@ -0,0 +1,83 @@
+package qrcode
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// RenderOptions control how the modules of a Matrix are drawn.
+type RenderOptions struct {
+	// ModuleSize is the width of a module in pixels, at least 1.
+	ModuleSize int
+
+	// QuietZone is the width of the light margin around the symbol in
+	// modules. ISO/IEC 18004 asks for 4.
+	QuietZone int
+
+	// Foreground is the colour of dark modules, black if nil, and Background
+	// the colour of light modules and the quiet zone, white if nil.
+	Foreground color.Color
+	Background color.Color
+}
+
+// DefaultRenderOptions are used when no options are given.
+var DefaultRenderOptions = RenderOptions{
+	ModuleSize: 4,
+	QuietZone:  4,
+}
+
+func (opts *RenderOptions) withDefaults() RenderOptions {
+	if opts == nil {
+		opts = &DefaultRenderOptions
+	}
+	o := *opts
+	o.ModuleSize = max(o.ModuleSize, 1)
+	o.QuietZone = max(o.QuietZone, 0)
+	if o.Foreground == nil {
+		o.Foreground = color.Black
+	}
+	if o.Background == nil {
+		o.Background = color.White
+	}
+	return o
+}
+
+// Image draws the modules in Points, true being dark, as a two colour image;
+// nil options mean DefaultRenderOptions.
+func (mx *Matrix) Image(opts *RenderOptions) *image.Paletted {
+	o := opts.withDefaults()
+	columns, rows := mx.gridSize()
+	width := (columns + 2*o.QuietZone) * o.ModuleSize
+	height := (rows + 2*o.QuietZone) * o.ModuleSize
+	img := image.NewPaletted(image.Rect(0, 0, width, height), color.Palette{o.Background, o.Foreground})
+	for y, line := range mx.Points {
+		for x, dark := range line {
+			if !dark {
+				continue
+			}
+			top := (y + o.QuietZone) * o.ModuleSize
+			left := (x + o.QuietZone) * o.ModuleSize
+			for py := top; py < top+o.ModuleSize; py++ {
+				row := img.Pix[py*img.Stride+left : py*img.Stride+left+o.ModuleSize]
+				for i := range row {
+					row[i] = 1
+				}
+			}
+		}
+	}
+	return img
+}
+
+// WritePNG writes the Image of the symbol as PNG.
+func (mx *Matrix) WritePNG(w io.Writer, opts *RenderOptions) error {
+	return png.Encode(w, mx.Image(opts))
+}
+
+// WriteJPEG writes the Image of the symbol as JPEG. A module size of a
+// multiple of 8 pixels keeps the compression artefacts inside the modules.
+func (mx *Matrix) WriteJPEG(w io.Writer, opts *RenderOptions, jpegOptions *jpeg.Options) error {
+	return jpeg.Encode(w, mx.Image(opts), jpegOptions)
+}
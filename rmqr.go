@@ -0,0 +1,423 @@
+package qrcode
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"math/bits"
+)
+
+// The format information of rMQR is masked differently next to the finder
+// pattern and next to the sub-finder pattern.
+const (
+	rmqrFormatMask    = 0x1fab2
+	rmqrSubFormatMask = 0x20a7b
+)
+
+// rmqrMask is the mask pattern of QR all rMQR symbols use.
+const rmqrMask = 4
+
+// RMQRVersion describes one of the 32 sizes of rMQR, ISO/IEC 23941, at its
+// two recovery levels Medium and Highest.
+type RMQRVersion struct {
+	// Version number, 1 to 32 for R7x43 to R17x139, one more than the
+	// version indicator in the format information.
+	Version int
+
+	// Height and Width in modules.
+	Height, Width int
+
+	// AlignmentColumns are the columns of the alignment patterns on the top
+	// and bottom edges, joined by vertical timing patterns.
+	AlignmentColumns []int
+
+	// Character count lengths of numeric, alphanumeric, byte and Kanji mode.
+	NumericCountBits, AlphanumericCountBits, ByteCountBits, KanjiCountBits int
+
+	// Blocks of level Medium and Highest.
+	Medium, Highest []Block
+
+	// Number of bits left over after the last codeword.
+	NumRemainderBits int
+}
+
+// RMQRVersions lists the rMQR sizes in the order of their version indicators.
+var RMQRVersions = []RMQRVersion{
+	{1, 7, 43, []int{21}, 4, 3, 3, 2, []Block{{1, 13, 6}}, []Block{{1, 13, 3}}, 0},
+	{2, 7, 59, []int{19, 39}, 5, 5, 4, 3, []Block{{1, 21, 12}}, []Block{{1, 21, 7}}, 3},
+	{3, 7, 77, []int{25, 51}, 6, 5, 5, 4, []Block{{1, 32, 20}}, []Block{{1, 32, 10}}, 5},
+	{4, 7, 99, []int{23, 49, 75}, 7, 6, 5, 5, []Block{{1, 44, 28}}, []Block{{1, 44, 14}}, 6},
+	{5, 7, 139, []int{27, 55, 83, 111}, 7, 6, 6, 5, []Block{{1, 68, 44}}, []Block{{2, 34, 12}}, 1},
+	{6, 9, 43, []int{21}, 5, 5, 4, 3, []Block{{1, 21, 12}}, []Block{{1, 21, 7}}, 2},
+	{7, 9, 59, []int{19, 39}, 6, 5, 5, 4, []Block{{1, 33, 21}}, []Block{{1, 33, 11}}, 3},
+	{8, 9, 77, []int{25, 51}, 7, 6, 5, 5, []Block{{1, 49, 31}}, []Block{{1, 24, 8}, {1, 25, 9}}, 1},
+	{9, 9, 99, []int{23, 49, 75}, 7, 6, 6, 5, []Block{{1, 66, 42}}, []Block{{2, 33, 11}}, 4},
+	{10, 9, 139, []int{27, 55, 83, 111}, 8, 7, 6, 6, []Block{{1, 49, 31}, {1, 50, 32}}, []Block{{3, 33, 11}}, 5},
+	{11, 11, 27, nil, 4, 4, 3, 2, []Block{{1, 15, 7}}, []Block{{1, 15, 5}}, 2},
+	{12, 11, 43, []int{21}, 6, 5, 5, 4, []Block{{1, 31, 19}}, []Block{{1, 31, 11}}, 1},
+	{13, 11, 59, []int{19, 39}, 7, 6, 5, 5, []Block{{1, 47, 31}}, []Block{{1, 23, 7}, {1, 24, 8}}, 0},
+	{14, 11, 77, []int{25, 51}, 7, 6, 6, 5, []Block{{1, 33, 21}, {1, 34, 22}}, []Block{{1, 33, 11}, {1, 34, 12}}, 2},
+	{15, 11, 99, []int{23, 49, 75}, 8, 7, 6, 6, []Block{{1, 44, 28}, {1, 45, 29}}, []Block{{1, 44, 14}, {1, 45, 15}}, 7},
+	{16, 11, 139, []int{27, 55, 83, 111}, 8, 7, 7, 6, []Block{{2, 66, 42}}, []Block{{3, 44, 14}}, 6},
+	{17, 13, 27, nil, 5, 5, 4, 3, []Block{{1, 21, 12}}, []Block{{1, 21, 7}}, 4},
+	{18, 13, 43, []int{21}, 6, 6, 5, 5, []Block{{1, 41, 27}}, []Block{{1, 41, 13}}, 1},
+	{19, 13, 59, []int{19, 39}, 7, 6, 6, 5, []Block{{1, 60, 38}}, []Block{{2, 30, 10}}, 6},
+	{20, 13, 77, []int{25, 51}, 7, 7, 6, 6, []Block{{1, 42, 26}, {1, 43, 27}}, []Block{{1, 42, 14}, {1, 43, 15}}, 4},
+	{21, 13, 99, []int{23, 49, 75}, 8, 7, 7, 6, []Block{{1, 56, 36}, {1, 57, 37}}, []Block{{1, 37, 11}, {2, 38, 12}}, 3},
+	{22, 13, 139, []int{27, 55, 83, 111}, 8, 8, 7, 7, []Block{{2, 55, 35}, {1, 56, 36}}, []Block{{2, 41, 13}, {2, 42, 14}}, 0},
+	{23, 15, 43, []int{21}, 7, 6, 6, 5, []Block{{1, 51, 33}}, []Block{{1, 25, 7}, {1, 26, 8}}, 1},
+	{24, 15, 59, []int{19, 39}, 7, 7, 6, 5, []Block{{1, 74, 48}}, []Block{{2, 37, 13}}, 4},
+	{25, 15, 77, []int{25, 51}, 8, 7, 7, 6, []Block{{1, 51, 33}, {1, 52, 34}}, []Block{{2, 34, 10}, {1, 35, 11}}, 6},
+	{26, 15, 99, []int{23, 49, 75}, 8, 7, 7, 6, []Block{{2, 68, 42}}, []Block{{4, 34, 10}}, 7},
+	{27, 15, 139, []int{27, 55, 83, 111}, 9, 8, 7, 7, []Block{{2, 66, 42}, {1, 67, 43}}, []Block{{1, 39, 13}, {4, 40, 14}}, 2},
+	{28, 17, 43, []int{21}, 7, 6, 6, 5, []Block{{1, 30, 18}, {1, 31, 19}}, []Block{{1, 30, 10}, {1, 31, 11}}, 1},
+	{29, 17, 59, []int{19, 39}, 8, 7, 6, 6, []Block{{2, 44, 28}}, []Block{{2, 44, 14}}, 2},
+	{30, 17, 77, []int{25, 51}, 8, 7, 7, 6, []Block{{2, 61, 39}}, []Block{{1, 40, 12}, {2, 41, 13}}, 0},
+	{31, 17, 99, []int{23, 49, 75}, 8, 8, 7, 6, []Block{{2, 53, 33}, {1, 54, 34}}, []Block{{4, 40, 14}}, 3},
+	{32, 17, 139, []int{27, 55, 83, 111}, 9, 8, 8, 7, []Block{{4, 58, 38}}, []Block{{2, 38, 12}, {4, 39, 13}}, 4},
+}
+
+// Name returns the name of the size, for example R7x43.
+func (v *RMQRVersion) Name() string {
+	return fmt.Sprintf("R%dx%d", v.Height, v.Width)
+}
+
+// qrCodeVersion returns the block structure of the size at level for
+// ParseBlock, nil at any level but Medium and Highest.
+func (v *RMQRVersion) qrCodeVersion(level RecoveryLevel) *QRcodeVersion {
+	blocks := map[RecoveryLevel][]Block{Medium: v.Medium, Highest: v.Highest}[level]
+	if blocks == nil {
+		return nil
+	}
+	return &QRcodeVersion{Version: v.Version, Level: level, Block: blocks, NumRemainderBits: v.NumRemainderBits}
+}
+
+// IsRMQR reports whether Points has the height and width of one of the rMQR
+// sizes.
+func (mx *Matrix) IsRMQR() bool {
+	return mx.RMQRVersion() != nil
+}
+
+// RMQRVersion returns the rMQR size of the symbol by its height and width, nil
+// if it is none.
+func (mx *Matrix) RMQRVersion() *RMQRVersion {
+	if len(mx.Points) == 0 {
+		return nil
+	}
+	return rmqrVersionOfSize(len(mx.Points), len(mx.Points[0]))
+}
+
+func rmqrVersionOfSize(height, width int) *RMQRVersion {
+	for i := range RMQRVersions {
+		if RMQRVersions[i].Height == height && RMQRVersions[i].Width == width {
+			return &RMQRVersions[i]
+		}
+	}
+	return nil
+}
+
+// rmqrFormatInfoPositions returns the modules of the two copies of the format
+// information of a symbol of the given size, most significant bit first: right
+// of the finder pattern and left of and above the sub-finder pattern.
+func rmqrFormatInfoPositions(height, width int) (fi1, fi2 []Point) {
+	for y := 3; y >= 1; y-- {
+		fi1 = append(fi1, Point{11, y})
+	}
+	for x := 10; x >= 8; x-- {
+		for y := 5; y >= 1; y-- {
+			fi1 = append(fi1, Point{x, y})
+		}
+	}
+	for x := 3; x <= 5; x++ {
+		fi2 = append(fi2, Point{width - x, height - 6})
+	}
+	for x := 6; x <= 8; x++ {
+		for y := 2; y <= 6; y++ {
+			fi2 = append(fi2, Point{width - x, height - y})
+		}
+	}
+	return fi1, fi2
+}
+
+// rmqrFormatBits returns the 18 unmasked format information bits of the
+// 6-bit format: the level bit, set for Highest, and the version indicator.
+func rmqrFormatBits(format int) int {
+	return format<<12 | bchVersion(format<<12)
+}
+
+// rmqrFormatInfo reads the format information of an rMQR symbol from either
+// copy, correcting up to 3 bit errors. Mask is always 4, the only mask
+// pattern of rMQR.
+func (mx *Matrix) rmqrFormatInfo() (*FormatInfo, error) {
+	fi1, fi2 := rmqrFormatInfoPositions(len(mx.Points), len(mx.Points[0]))
+	read := []int{mx.GetBin(fi1) ^ rmqrFormatMask, mx.GetBin(fi2) ^ rmqrSubFormatMask}
+	for _, bin := range read {
+		for format := 0; format < 64; format++ {
+			if bits.OnesCount(uint(bin^rmqrFormatBits(format))) > 3 {
+				continue
+			}
+			version := &RMQRVersions[format&0x1f]
+			if version != mx.RMQRVersion() {
+				return nil, fmt.Errorf("format information of %s in a symbol of %s", version.Name(), mx.RMQRVersion().Name())
+			}
+			level := Medium
+			if format>>5 == 1 {
+				level = Highest
+			}
+			return &FormatInfo{
+				ErrorCorrectionLevel: int(level),
+				Mask:                 rmqrMask,
+				RMQRVersion:          version.Version,
+			}, nil
+		}
+	}
+	return nil, errors.New("not found error correction level and version")
+}
+
+// rmqrFunctionModules marks the function patterns of an rMQR size: the finder
+// pattern with its separator and the format information next to it, the
+// sub-finder pattern with the other copy of the format information, the
+// corner patterns, the alignment patterns and the timing patterns along all
+// four edges and between the alignment patterns.
+func rmqrFunctionModules(version *RMQRVersion) [][]bool {
+	height, width := version.Height, version.Width
+	function := make([][]bool, height)
+	for y := range function {
+		function[y] = make([]bool, width)
+	}
+	reserve := func(x0, y0, x1, y1 int) {
+		for y := max(y0, 0); y <= min(y1, height-1); y++ {
+			for x := max(x0, 0); x <= min(x1, width-1); x++ {
+				function[y][x] = true
+			}
+		}
+	}
+	reserve(0, 0, 7, 7)
+	reserve(8, 1, 10, 5)
+	reserve(11, 1, 11, 3)
+	reserve(width-5, height-5, width-1, height-1)
+	reserve(width-8, height-6, width-6, height-2)
+	reserve(width-5, height-6, width-3, height-6)
+	reserve(width-2, 1, width-2, 1)
+	reserve(0, height-2, 1, height-1)
+	reserve(0, 0, width-1, 0)
+	reserve(0, height-1, width-1, height-1)
+	reserve(0, 0, 0, height-1)
+	reserve(width-1, 0, width-1, height-1)
+	for _, x := range version.AlignmentColumns {
+		reserve(x-1, 0, x+1, 2)
+		reserve(x-1, height-3, x+1, height-1)
+		reserve(x, 0, x, height-1)
+	}
+	return function
+}
+
+// rmqrDataArea marks the modules of an rMQR symbol that hold data.
+func (mx *Matrix) rmqrDataArea() *Matrix {
+	da := new(Matrix)
+	for _, line := range rmqrFunctionModules(mx.RMQRVersion()) {
+		l := make([]bool, len(line))
+		for x, function := range line {
+			l[x] = !function
+		}
+		da.Points = append(da.Points, l)
+	}
+	return da
+}
+
+// rmqrDataPositions lists the modules of dataArea that hold data like
+// DataPositions. The pairs of columns start left of the right edge, which is
+// all function patterns.
+func rmqrDataPositions(dataArea *Matrix) []Point {
+	height, width := len(dataArea.Points), len(dataArea.Points[0])
+	var positions []Point
+	up := true
+	for t := width - 2; t > 0; t -= 2 {
+		for i := 0; i < height; i++ {
+			y := i
+			if up {
+				y = height - 1 - i
+			}
+			for x := t; x >= t-1; x-- {
+				if dataArea.AtPoints(x, y) {
+					positions = append(positions, Point{x, y})
+				}
+			}
+		}
+		up = !up
+	}
+	return positions
+}
+
+// rmqrStreamFormat returns the stream format of an rMQR size: 3-bit mode
+// indicators for numeric, alphanumeric, byte and Kanji mode, FNC1 and ECI,
+// with no Structured Append, and a 3-bit terminator.
+func rmqrStreamFormat(version int) (*streamFormat, error) {
+	if version < 1 || version > len(RMQRVersions) {
+		return nil, fmt.Errorf("invalid rMQR version %d", version)
+	}
+	v := &RMQRVersions[version-1]
+	return &streamFormat{
+		encoder: &dataEncoder{
+			minVersion:                   version,
+			maxVersion:                   version,
+			numNumericCharCountBits:      v.NumericCountBits,
+			numAlphanumericCharCountBits: v.AlphanumericCountBits,
+			numByteCharCountBits:         v.ByteCountBits,
+			numKanjiCharCountBits:        v.KanjiCountBits,
+		},
+		modeBits: 3,
+		modes: []int{
+			modeTerminator, ModeNumeric, ModeAlphanumeric, ModeByte,
+			ModeKanji, modeFNC1First, modeFNC1Second, modeECI,
+		},
+		terminatorBits: 3,
+	}, nil
+}
+
+// ParseRMQRDataStream decodes the data bit stream of an rMQR symbol of version
+// 1 to 32 like ParseDataStream.
+func ParseRMQRDataStream(dataCode []bool, version int) (*DataStream, error) {
+	format, err := rmqrStreamFormat(version)
+	if err != nil {
+		return nil, err
+	}
+	return parseStream(dataCode, format, -1, nil)
+}
+
+// checkRMQRSize returns an error unless Points is a grid of one of the rMQR
+// sizes.
+func (mx *Matrix) checkRMQRSize() error {
+	version := mx.RMQRVersion()
+	if version == nil {
+		return errors.New("invalid rMQR symbol size")
+	}
+	for _, line := range mx.Points {
+		if len(line) != version.Width {
+			return errors.New("rows of different widths")
+		}
+	}
+	return nil
+}
+
+// parseRMQRBlock corrects the blocks of an rMQR symbol like ParseBlock.
+func parseRMQRBlock(m *Matrix, data []bool, confidence []float64, threshold float64) ([]bool, *ErrorCorrectionStats, error) {
+	if err := m.checkRMQRSize(); err != nil {
+		return nil, nil, err
+	}
+	info, err := m.FormatInfo()
+	if err != nil {
+		return nil, nil, err
+	}
+	rmqrVersion := m.RMQRVersion()
+	version := rmqrVersion.qrCodeVersion(RecoveryLevel(info.ErrorCorrectionLevel))
+	if version == nil {
+		return nil, nil, fmt.Errorf("%s has no level %d", rmqrVersion.Name(), info.ErrorCorrectionLevel)
+	}
+	return correctBlocks(version, rmqrVersion.Name(), data, confidence, 0, threshold)
+}
+
+// rmqrPatternErrors counts how many modules of the sub-finder pattern and the
+// corner patterns differ from what they should be.
+func (mx *Matrix) rmqrPatternErrors() int {
+	height, width := len(mx.Points), len(mx.Points[0])
+	wrong := 0
+	expect := func(x, y int, dark bool) {
+		if mx.AtPoints(x, y) != dark {
+			wrong++
+		}
+	}
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 5; x++ {
+			ring := x == 0 || x == 4 || y == 0 || y == 4
+			expect(width-5+x, height-5+y, ring || x == 2 && y == 2)
+		}
+	}
+	expect(width-2, 0, true)
+	expect(width-1, 0, true)
+	expect(width-1, 1, true)
+	expect(width-2, 1, false)
+	for x := 0; x < 3; x++ {
+		expect(x, height-1, true)
+	}
+	if height >= 11 {
+		expect(0, height-2, true)
+		expect(1, height-2, false)
+	}
+	return wrong
+}
+
+// maxRMQRPatternErrors is how many modules of the sub-finder and corner
+// patterns may be wrong in a sampled rMQR symbol.
+const maxRMQRPatternErrors = 3
+
+// sampleRMQR samples an rMQR symbol from its finder pattern. The symbol
+// extends to the right along the timing pattern of its top edge, whose gaps
+// are at most one module wide, and down along its right edge to the bottom
+// of the sub-finder pattern. The sub-finder and corner patterns are checked
+// once the modules are sampled.
+func (mx *Matrix) sampleRMQR(positionDetectionPattern []*PointGroup) (*Matrix, error) {
+	// A finder pattern is 7 modules wide, its centre 3.
+	lineWidth := LineWidth([][]*PointGroup{positionDetectionPattern}) * 3
+	outer := positionDetectionPattern[1]
+	left, top := float64(outer.Min.X), float64(outer.Min.Y)
+
+	// edge follows the dark pixels at(p) from start across gaps of up to a
+	// module and a half and returns the end of the last one.
+	edge := func(at func(p int) bool, start, limit int) float64 {
+		last := start
+		for p := start; p < limit && float64(p-last) <= lineWidth*1.5; p++ {
+			if at(p) {
+				last = p
+			}
+		}
+		return float64(last + 1)
+	}
+	// nearest returns the one of sizes nearest to length modules.
+	nearest := func(length float64, sizes []int) int {
+		best := sizes[0]
+		for _, size := range sizes {
+			if math.Abs(float64(size)-length) < math.Abs(float64(best)-length) {
+				best = size
+			}
+		}
+		return best
+	}
+
+	row := int(top + lineWidth/2)
+	right := edge(func(p int) bool { return mx.AtOrgPoints(p, row) }, int(left), mx.OrgSize.Max.X)
+	width := nearest((right-left)/lineWidth, []int{27, 43, 59, 77, 99, 139})
+	moduleX := (right - left) / float64(width)
+	column := int(left + (float64(width)-0.5)*moduleX)
+	bottom := edge(func(p int) bool { return mx.AtOrgPoints(column, p) }, int(top), mx.OrgSize.Max.Y)
+	height := nearest((bottom-top)/lineWidth, []int{7, 9, 11, 13, 15, 17})
+	moduleY := (bottom - top) / float64(height)
+	if rmqrVersionOfSize(height, width) == nil {
+		return nil, fmt.Errorf("invalid rMQR symbol of %d by %d modules", width, height)
+	}
+
+	radius := int(min(moduleX, moduleY) / 4)
+	var points PointsMatrix
+	var confidences [][]float64
+	for y := 0; y < height; y++ {
+		var line []bool
+		var confidence []float64
+		for x := 0; x < width; x++ {
+			px := int(left + (float64(x)+0.5)*moduleX)
+			py := int(top + (float64(y)+0.5)*moduleY)
+			line = append(line, mx.AtOrgPoints(px, py))
+			confidence = append(confidence, mx.SampleConfidence(px, py, radius))
+		}
+		points = append(points, line)
+		confidences = append(confidences, confidence)
+	}
+	symbol := &Matrix{Points: points}
+	if symbol.rmqrPatternErrors() > maxRMQRPatternErrors {
+		return nil, fmt.Errorf("no sub-finder and corner patterns of %s", rmqrVersionOfSize(height, width).Name())
+	}
+	mx.Points = points
+	mx.Confidence = confidences
+	mx.Size = image.Rect(0, 0, width, height)
+	return mx, nil
+}
@@ -0,0 +1,156 @@
+package qrcode
+
+import (
+	"fmt"
+	"math"
+)
+
+// segmentState is the mode of the last segment while content is split into
+// segments, and how many characters of it are left over from the groups of
+// three digits or two alphanumeric characters.
+type segmentState struct {
+	mode     int
+	leftover int
+}
+
+var segmentStates = []segmentState{
+	{ModeNumeric, 0}, {ModeNumeric, 1}, {ModeNumeric, 2},
+	{ModeAlphanumeric, 0}, {ModeAlphanumeric, 1},
+	{ModeByte, 0},
+	{ModeKanji, 0},
+}
+
+// next returns the index in segmentStates of the state after one more
+// character and the bits the character adds: a third digit completes 10 bits
+// from 4 and 7, a second alphanumeric character 11 bits from 6.
+func (s segmentState) next() (int, int) {
+	switch s.mode {
+	case ModeNumeric:
+		return (s.leftover + 1) % 3, []int{4, 3, 3}[s.leftover]
+	case ModeAlphanumeric:
+		return 3 + (s.leftover+1)%2, []int{6, 5}[s.leftover]
+	case ModeByte:
+		return 5, 8
+	}
+	return 6, 13
+}
+
+// OptimalSegments splits content into the segments of numeric, alphanumeric,
+// byte and Kanji mode that take the fewest bits in a symbol of version, whose
+// character count indicators differ in length between versions 1 to 9, 10 to
+// 26 and 27 to 40. Kanji mode is only used for content detected as Shift JIS
+// by DetectCharset, since a pair of bytes in another character set may look
+// like a Kanji. The segments have their Mode and Data set for EncodeSegments.
+func OptimalSegments(content []byte, version int) ([]Segment, error) {
+	format, err := qrStreamFormat(version)
+	if err != nil {
+		return nil, err
+	}
+	return optimalSegments(content, format)
+}
+
+// optimalSegments splits content like OptimalSegments into the modes of
+// format, failing when some character fits none of them.
+func optimalSegments(content []byte, format *streamFormat) ([]Segment, error) {
+	kanji := DetectCharset(content) == CharsetShiftJIS
+
+	// cost[i][s] is the fewest bits of content[:i] split into segments, the
+	// last of them in state s; from[i][s] tells where the last character
+	// came from.
+	type step struct {
+		pos, state int
+		start      bool
+	}
+	cost := make([][]int, len(content)+1)
+	from := make([][]step, len(content)+1)
+	for i := range cost {
+		cost[i] = make([]int, len(segmentStates))
+		from[i] = make([]step, len(segmentStates))
+		for s := range cost[i] {
+			cost[i][s] = math.MaxInt
+		}
+	}
+	// best returns the state with the fewest bits at i, -1 at the start.
+	best := func(i int) int {
+		if i == 0 {
+			return -1
+		}
+		state := 0
+		for s := range cost[i] {
+			if cost[i][s] < cost[i][state] {
+				state = s
+			}
+		}
+		return state
+	}
+	relax := func(i, state int, bits int, prev step) {
+		if bits < cost[i][state] {
+			cost[i][state] = bits
+			from[i][state] = prev
+		}
+	}
+
+	for i := 0; i < len(content); i++ {
+		for _, mode := range format.segmentModes() {
+			width := 1
+			switch mode {
+			case ModeNumeric:
+				if !isDigits(content[i : i+1]) {
+					continue
+				}
+			case ModeAlphanumeric:
+				if !isAlphanumeric(content[i : i+1]) {
+					continue
+				}
+			case ModeKanji:
+				if !kanji || i+1 >= len(content) {
+					continue
+				}
+				if _, ok := compactDoubleByte(ModeKanji, int(content[i])<<8|int(content[i+1])); !ok {
+					continue
+				}
+				width = 2
+			}
+
+			// Continue a segment of mode.
+			for s, state := range segmentStates {
+				if state.mode != mode || cost[i][s] == math.MaxInt {
+					continue
+				}
+				next, bits := state.next()
+				relax(i+width, next, cost[i][s]+bits, step{pos: i, state: s})
+			}
+			// Start a new segment of mode.
+			prev := best(i)
+			bits := 0
+			if prev >= 0 {
+				if cost[i][prev] == math.MaxInt {
+					continue
+				}
+				bits = cost[i][prev]
+			}
+			next, charBits := segmentState{mode: mode}.next()
+			bits += format.modeBits + format.encoder.countBits(mode) + charBits
+			relax(i+width, next, bits, step{pos: i, state: prev, start: true})
+		}
+	}
+
+	if len(content) > 0 && cost[len(content)][best(len(content))] == math.MaxInt {
+		return nil, fmt.Errorf("%q does not fit the modes %v", content, format.segmentModes())
+	}
+	var segments []Segment
+	end := len(content)
+	for pos, state := len(content), best(len(content)); pos > 0; {
+		prev := from[pos][state]
+		if prev.start {
+			segments = append([]Segment{{
+				Mode: segmentStates[state].mode,
+				Data: content[prev.pos:end],
+				ECI:  -1,
+			}}, segments...)
+			end = prev.pos
+		}
+		pos, state = prev.pos, prev.state
+	}
+	return segments, nil
+}
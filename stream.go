@@ -0,0 +1,387 @@
+package qrcode
+
+import "errors"
+
+// Mode indicators of character segments.
+const (
+	ModeNumeric      = 1
+	ModeAlphanumeric = 2
+	ModeByte         = 4
+	ModeKanji        = 8
+	ModeHanzi        = 13
+)
+
+// Mode indicators that do not start a character segment.
+const (
+	modeTerminator       = 0
+	modeStructuredAppend = 3
+	modeFNC1First        = 5
+	modeECI              = 7
+	modeFNC1Second       = 9
+)
+
+// DataStream is the decoded data bit stream of a symbol.
+type DataStream struct {
+	// Content is the decoded data, with byte segments transcoded to UTF-8
+	// according to the ECI in effect. Byte segments of an ECI assignment
+	// that is not supported are left as they are in Raw.
+	Content []byte
+
+	// Raw is the data as it is encoded in the symbol: byte segments before
+	// ECI transcoding, Kanji segments as Shift JIS and Hanzi segments as
+	// GB2312.
+	Raw []byte
+
+	// ECI lists the ECI assignment numbers in the order they appear.
+	ECI []int
+
+	// StructuredAppend is the Structured Append header of the symbol, or nil
+	// when the symbol stands alone.
+	StructuredAppend *StructuredAppend
+
+	// FNC1 is set when the data is formatted as GS1 or industry application
+	// data.
+	FNC1 *FNC1
+
+	// Charset is the character set detected for the byte segments no ECI
+	// applies to, empty when there are none.
+	Charset string
+
+	// Segments lists the character segments in the order they appear.
+	Segments []Segment
+
+	// spans records the bits of every segment and header for
+	// AuditDataStream, and truncated whether a segment declares more
+	// characters than the data holds.
+	spans     []AuditSpan
+	truncated bool
+
+	// undetected holds the spans of Content with byte data no ECI applies
+	// to until their character set is detected.
+	undetected [][2]int
+}
+
+// Segment is a character segment of the data bit stream.
+type Segment struct {
+	// Mode is the mode indicator of the segment: ModeNumeric,
+	// ModeAlphanumeric, ModeByte, ModeKanji or ModeHanzi.
+	Mode int
+
+	// Count is the number of characters the character count indicator
+	// declares: digits, alphanumeric characters, bytes, Kanji or Hanzi.
+	Count int
+
+	// Bits is the segment as it is in the bit stream, from the mode
+	// indicator to the last data bit. It is shorter than the header declares
+	// when the segment is truncated.
+	Bits []bool
+
+	// Data is the decoded data of the segment as it contributes to
+	// DataStream.Raw: byte data before transcoding, Kanji as Shift JIS and
+	// Hanzi as GB2312.
+	Data []byte
+
+	// ECI is the ECI assignment in effect for the segment, -1 if none.
+	ECI int
+}
+
+// ParseDataStream decodes the data bit stream of a symbol. The stream is a
+// sequence of segments, each starting with a 4-bit mode indicator, that ends
+// with the 0000 terminator or when fewer than 4 bits are left. The decoded
+// segments are concatenated. A truncated first segment is decoded as far as
+// the data goes; any later segment that does not parse or does not fit is
+// taken as trailing data and ends the stream.
+//
+// An ECI segment switches the character set of the byte segments that follow
+// it until the next ECI segment; the character set of byte segments before
+// any ECI is guessed by DetectCharset. Byte segments of an ECI assignment
+// that is not supported are not transcoded. A Structured Append header is recorded in
+// StructuredAppend and an FNC1 mode indicator in FNC1.
+func ParseDataStream(dataCode []bool, version int) (*DataStream, error) {
+	format, err := qrStreamFormat(version)
+	if err != nil {
+		return nil, err
+	}
+	return parseStream(dataCode, format, -1, nil)
+}
+
+// streamFormat tells how the data bit stream of a kind of symbol encodes its
+// segments.
+type streamFormat struct {
+	encoder *dataEncoder
+
+	// modeBits is the length of the mode indicator. Micro QR numbers its
+	// modes in order, modes maps those numbers to the modes of QR; the mode
+	// indicators of QR are the modes themselves.
+	modeBits int
+	modes    []int
+
+	// terminatorBits is the length of the terminator.
+	terminatorBits int
+}
+
+func qrStreamFormat(version int) (*streamFormat, error) {
+	encoder, err := GetDataEncoder(version)
+	if err != nil {
+		return nil, err
+	}
+	return &streamFormat{encoder: encoder, modeBits: 4, terminatorBits: 4}, nil
+}
+
+// mode reads the mode indicator at the start of data; -1 stands for an
+// indicator Micro QR does not define.
+func (f *streamFormat) mode(data []bool) int {
+	mode := Bit2Int(data[:f.modeBits])
+	if f.modes == nil {
+		return mode
+	}
+	if mode >= len(f.modes) {
+		return -1
+	}
+	return f.modes[mode]
+}
+
+// segmentModes returns the modes segments can have in the format, other than
+// Hanzi mode.
+func (f *streamFormat) segmentModes() []int {
+	if f.modes != nil {
+		return f.modes
+	}
+	return []int{ModeNumeric, ModeAlphanumeric, ModeByte, ModeKanji}
+}
+
+// indicator returns the mode indicator of mode, false when the format has no
+// such mode.
+func (f *streamFormat) indicator(mode int) (int, bool) {
+	if f.modes == nil {
+		return mode, true
+	}
+	for i, m := range f.modes {
+		if m == mode {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// parseStream decodes a data bit stream of format like ParseDataStream,
+// starting with eci and fnc1 in effect; -1 means no ECI.
+func parseStream(dataCode []bool, format *streamFormat, eci int, fnc1 *FNC1) (*DataStream, error) {
+	stream, err := readStream(dataCode, format, eci, fnc1)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.transcodeUndetected(); err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// readStream decodes a data bit stream like parseStream but leaves the byte
+// data no ECI applies to untranscoded in Content, with its spans in
+// undetected.
+func readStream(dataCode []bool, format *streamFormat, eci int, fnc1 *FNC1) (*DataStream, error) {
+	if len(dataCode) < format.terminatorBits {
+		return nil, errors.New("data too short for a mode indicator")
+	}
+	encoder := format.encoder
+	var err error
+
+	stream := &DataStream{FNC1: fnc1}
+	offset := 0
+	// advance consumes the n bits of a header or segment.
+	advance := func(kind AuditKind, mode, n int) {
+		segment := -1
+		if kind == AuditSegment {
+			segment = len(stream.Segments) - 1
+		}
+		stream.spans = append(stream.spans, AuditSpan{Kind: kind, Start: offset, End: offset + n, Mode: mode, Segment: segment})
+		offset += n
+		dataCode = dataCode[n:]
+	}
+	var pending []byte
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		if eci < 0 {
+			stream.undetected = append(stream.undetected, [2]int{len(stream.Content), len(stream.Content) + len(pending)})
+			stream.Content = append(stream.Content, pending...)
+			pending = nil
+			return nil
+		}
+		content := pending
+		// Bytes of an ECI assignment that is not supported stay as they are.
+		if _, err := ECICharset(eci); err == nil {
+			content, err = ECIToUTF8(eci, pending)
+			if err != nil {
+				return err
+			}
+		}
+		stream.Content = append(stream.Content, content...)
+		pending = nil
+		return nil
+	}
+
+	for first := true; len(dataCode) >= format.terminatorBits; first = false {
+		if Bit2Int(dataCode[:format.terminatorBits]) == modeTerminator {
+			break
+		}
+		// The mode indicator comes first, the segment data follows
+		mode := format.mode(dataCode)
+		n := format.modeBits
+
+		if mode == modeECI {
+			designator, used, err := ParseECIDesignator(dataCode[n:])
+			if err != nil {
+				if first {
+					return nil, err
+				}
+				break
+			}
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			eci = designator
+			stream.ECI = append(stream.ECI, eci)
+			advance(AuditHeader, mode, n+used)
+			continue
+		}
+
+		if mode == modeStructuredAppend {
+			header, err := ParseStructuredAppend(dataCode[n:])
+			if err != nil {
+				if first {
+					return nil, err
+				}
+				break
+			}
+			stream.StructuredAppend = header
+			advance(AuditHeader, mode, n+structuredAppendBits)
+			continue
+		}
+
+		if mode == modeFNC1First {
+			stream.FNC1 = &FNC1{Position: 1}
+			advance(AuditHeader, mode, n)
+			continue
+		}
+
+		if mode == modeFNC1Second {
+			indicator, err := ParseApplicationIndicator(dataCode[n:])
+			if err != nil {
+				if first {
+					return nil, err
+				}
+				break
+			}
+			stream.FNC1 = &FNC1{Position: 2, ApplicationIndicator: indicator}
+			advance(AuditHeader, mode, n+8)
+			continue
+		}
+
+		err = encoder.SetCharModeCharDecoder(mode)
+		if err != nil {
+			if first {
+				return nil, err
+			}
+			break
+		}
+
+		segment, used, err := encoder.ModeCharDecoder.Decode(dataCode[n:])
+		if err != nil {
+			if first {
+				return nil, err
+			}
+			break
+		}
+		truncated := n+used > len(dataCode)
+		if truncated {
+			stream.truncated = true
+			if !first {
+				break
+			}
+		}
+
+		raw := segment
+		switch decoder := encoder.ModeCharDecoder.(type) {
+		case *KanjiDecoder:
+			raw, _, err = decoder.DecodeShiftJIS(dataCode[n:])
+		case *HanziDecoder:
+			raw, _, err = decoder.DecodeGB2312(dataCode[n:])
+		}
+		if err != nil {
+			return nil, err
+		}
+		stream.Raw = append(stream.Raw, raw...)
+		stream.Segments = append(stream.Segments, Segment{
+			Mode:  mode,
+			Count: encoder.charCount(mode, dataCode[n:]),
+			Bits:  append([]bool{}, dataCode[:min(n+used, len(dataCode))]...),
+			Data:  raw,
+			ECI:   eci,
+		})
+		if _, ok := encoder.ModeCharDecoder.(*AlphanumericDecoder); ok && stream.FNC1 != nil {
+			segment = FNC1Alphanumeric(segment)
+		}
+		if _, ok := encoder.ModeCharDecoder.(*EightBitDecoder); ok {
+			pending = append(pending, segment...)
+		} else {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			stream.Content = append(stream.Content, segment...)
+		}
+		advance(AuditSegment, mode, min(n+used, len(dataCode)))
+		if truncated {
+			break
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// appendUndetected appends the Content of part to that of s, keeping the
+// byte data no ECI applies to untranscoded. Such data that continues right
+// where the previous one ended joins its span, so that a character split
+// between the two is transcoded whole.
+func (s *DataStream) appendUndetected(part *DataStream) {
+	offset := len(s.Content)
+	for _, span := range part.undetected {
+		span = [2]int{span[0] + offset, span[1] + offset}
+		if n := len(s.undetected); n > 0 && s.undetected[n-1][1] == span[0] {
+			s.undetected[n-1][1] = span[1]
+			continue
+		}
+		s.undetected = append(s.undetected, span)
+	}
+	s.Content = append(s.Content, part.Content...)
+}
+
+// transcodeUndetected detects the character set of all the byte data no ECI
+// applies to at once, and transcodes it to UTF-8.
+func (s *DataStream) transcodeUndetected() error {
+	if len(s.undetected) == 0 {
+		return nil
+	}
+	var data []byte
+	for _, span := range s.undetected {
+		data = append(data, s.Content[span[0]:span[1]]...)
+	}
+	s.Charset = DetectCharset(data)
+	var content []byte
+	last := 0
+	for _, span := range s.undetected {
+		transcoded, err := CharsetToUTF8(s.Charset, s.Content[span[0]:span[1]])
+		if err != nil {
+			return err
+		}
+		content = append(append(content, s.Content[last:span[0]]...), transcoded...)
+		last = span[1]
+	}
+	s.Content = append(content, s.Content[last:]...)
+	s.undetected = nil
+	return nil
+}
@@ -0,0 +1,256 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"unicode/utf8"
+)
+
+// structuredAppendBits is the length of a Structured Append header after the
+// mode indicator: symbol sequence indicator and parity data.
+const structuredAppendBits = 16
+
+// StructuredAppend is the header of a symbol that carries one part of a
+// message split over up to 16 symbols.
+type StructuredAppend struct {
+	// Index is the position of the symbol in the message, starting at 0.
+	Index int
+
+	// Total is the number of symbols of the message.
+	Total int
+
+	// Parity is the XOR of all data bytes of the whole message. It is the
+	// same in every symbol of a message.
+	Parity byte
+}
+
+func (sa *StructuredAppend) String() string {
+	return fmt.Sprintf("part %d of %d (parity %#02x)", sa.Index+1, sa.Total, sa.Parity)
+}
+
+// ParseStructuredAppend reads the header that follows a Structured Append
+// mode indicator: a 4-bit symbol position, a 4-bit total number of symbols
+// minus one and 8 bits of parity data.
+func ParseStructuredAppend(data []bool) (*StructuredAppend, error) {
+	if len(data) < structuredAppendBits {
+		return nil, errors.New("structured append header too short")
+	}
+	header := &StructuredAppend{
+		Index:  Bit2Int(data[0:4]),
+		Total:  Bit2Int(data[4:8]) + 1,
+		Parity: Bit2Byte(data[8:16]),
+	}
+	if header.Index >= header.Total {
+		return nil, fmt.Errorf("structured append symbol %d out of %d", header.Index+1, header.Total)
+	}
+	return header, nil
+}
+
+// bits returns the header with its mode indicator as it is encoded.
+func (sa *StructuredAppend) bits() []bool {
+	bits := appendBits(nil, modeStructuredAppend, 4)
+	bits = appendBits(bits, sa.Index, 4)
+	bits = appendBits(bits, sa.Total-1, 4)
+	return appendBits(bits, int(sa.Parity), 8)
+}
+
+// maxStructuredAppendSymbols is the most symbols a message can be split
+// over.
+const maxStructuredAppendSymbols = 16
+
+// EncodeStructuredAppend splits content over as few symbols of at most
+// maxVersion as hold it, up to 16, each with a Structured Append header
+// carrying its position and the parity of the whole content. Every symbol is
+// filled up before the next one is started, the parts are cut between
+// characters of UTF-8 or Shift JIS text, and each is encoded like Encode in
+// the smallest version that holds it. Content that fits in one symbol is
+// returned as part 1 of 1.
+func EncodeStructuredAppend(content []byte, level RecoveryLevel, maxVersion int) ([]*Matrix, error) {
+	if maxVersion < 1 || maxVersion > 40 {
+		return nil, fmt.Errorf("invalid version %d", maxVersion)
+	}
+	qrCodeVersion := getQRCodeVersion(maxVersion, level)
+	if qrCodeVersion == nil {
+		return nil, fmt.Errorf("version %d not found", maxVersion)
+	}
+	capacity := qrCodeVersion.numDataCodewords()*8 - 4 - structuredAppendBits
+	fits := func(part []byte) (bool, error) {
+		segments, err := OptimalSegments(part, maxVersion)
+		if err != nil {
+			return false, err
+		}
+		_, bits, ok, err := encodeSegments(segments, maxVersion)
+		return ok && len(bits) <= capacity, err
+	}
+
+	boundaries := charBoundaries(content)
+	var parts [][]byte
+	for rest := content; len(parts) == 0 || len(rest) > 0; {
+		// The longest prefix that fits, found among the character
+		// boundaries since the bits grow with the length.
+		lo, hi := 0, len(boundaries)-1
+		for lo < hi {
+			mid := (lo + hi + 1) / 2
+			ok, err := fits(rest[:boundaries[mid]-(len(content)-len(rest))])
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				lo = mid
+			} else {
+				hi = mid - 1
+			}
+		}
+		n := boundaries[lo] - (len(content) - len(rest))
+		if n == 0 && len(rest) > 0 {
+			return nil, fmt.Errorf("character at %d does not fit in version %d", len(content)-len(rest), maxVersion)
+		}
+		parts = append(parts, rest[:n])
+		rest = rest[n:]
+		boundaries = boundaries[lo:]
+		if len(parts) > maxStructuredAppendSymbols {
+			return nil, fmt.Errorf("data too long for %d symbols up to version %d", maxStructuredAppendSymbols, maxVersion)
+		}
+	}
+
+	var parity byte
+	for _, b := range content {
+		parity ^= b
+	}
+	symbols := make([]*Matrix, len(parts))
+	for i, part := range parts {
+		header := &StructuredAppend{Index: i, Total: len(parts), Parity: parity}
+		symbol, err := encode(func(version int) ([]Segment, error) {
+			return OptimalSegments(part, version)
+		}, level, header, maxVersion)
+		if err != nil {
+			return nil, err
+		}
+		symbol.Content = string(part)
+		symbols[i] = symbol
+	}
+	return symbols, nil
+}
+
+// charBoundaries lists the offsets in content between characters, from 0 to
+// len(content): between runes of UTF-8, between the single and double byte
+// characters of Shift JIS, and between all bytes otherwise.
+func charBoundaries(content []byte) []int {
+	boundaries := []int{0}
+	switch DetectCharset(content) {
+	case CharsetUTF8:
+		for i := 1; i <= len(content); i++ {
+			if i == len(content) || utf8.RuneStart(content[i]) {
+				boundaries = append(boundaries, i)
+			}
+		}
+	case CharsetShiftJIS:
+		for i := 0; i < len(content); i++ {
+			c := content[i]
+			if (c >= 0x81 && c <= 0x9f || c >= 0xe0 && c <= 0xfc) && i+1 < len(content) {
+				i++
+			}
+			boundaries = append(boundaries, i+1)
+		}
+	default:
+		for i := 1; i <= len(content); i++ {
+			boundaries = append(boundaries, i)
+		}
+	}
+	return boundaries
+}
+
+// JoinStructuredAppend reassembles a message from the decoded symbols of a
+// Structured Append, given in any order, for example the results of Decode on
+// several images or of DecodeAll. A symbol decoded more than once is only
+// counted once. The parity data of the headers is checked against the joined
+// data, and the ECI and FNC1 mode in effect at the end of a symbol carry over
+// to the next one. The character set of the byte data no ECI applies to is
+// detected over all symbols at once, since a character may be split between
+// two of them.
+func JoinStructuredAppend(symbols []*Matrix) (*DataStream, error) {
+	if len(symbols) == 0 {
+		return nil, errors.New("no structured append symbols")
+	}
+
+	var header *StructuredAppend
+	parts := make(map[int]*Matrix)
+	for _, symbol := range symbols {
+		sa := symbol.StructuredAppend
+		if sa == nil {
+			return nil, errors.New("symbol is not part of a structured append")
+		}
+		if header == nil {
+			header = sa
+		}
+		if sa.Total != header.Total {
+			return nil, fmt.Errorf("symbols of %d and %d parts mixed", header.Total, sa.Total)
+		}
+		if sa.Parity != header.Parity {
+			return nil, fmt.Errorf("symbols with parity %#02x and %#02x mixed", header.Parity, sa.Parity)
+		}
+		if part, ok := parts[sa.Index]; ok && !bytes.Equal(part.Raw, symbol.Raw) {
+			return nil, fmt.Errorf("part %d of %d found twice with different data", sa.Index+1, sa.Total)
+		}
+		parts[sa.Index] = symbol
+	}
+
+	indexes := make([]int, 0, len(parts))
+	for index := range parts {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	for i := 0; i < header.Total; i++ {
+		if i >= len(indexes) || indexes[i] != i {
+			return nil, fmt.Errorf("missing part %d of %d", i+1, header.Total)
+		}
+	}
+
+	joined := new(DataStream)
+	eci := -1
+	for _, index := range indexes {
+		part := &DataStream{
+			Content:  []byte(parts[index].Content),
+			Raw:      parts[index].Raw,
+			ECI:      parts[index].ECI,
+			Segments: parts[index].Segments,
+		}
+		if parts[index].Data != nil {
+			format, err := qrStreamFormat(parts[index].Version())
+			if err != nil {
+				return nil, err
+			}
+			part, err = readStream(parts[index].Data, format, eci, joined.FNC1)
+			if err != nil {
+				return nil, err
+			}
+		} else if joined.Charset == "" {
+			// Only the transcoded content is left.
+			joined.Charset = parts[index].Charset
+		}
+		if part.FNC1 != nil {
+			joined.FNC1 = part.FNC1
+		}
+		if len(part.ECI) > 0 {
+			eci = part.ECI[len(part.ECI)-1]
+		}
+		joined.appendUndetected(part)
+		joined.Raw = append(joined.Raw, part.Raw...)
+		joined.ECI = append(joined.ECI, part.ECI...)
+		joined.Segments = append(joined.Segments, part.Segments...)
+	}
+
+	var parity byte
+	for _, b := range joined.Raw {
+		parity ^= b
+	}
+	if parity != header.Parity {
+		return nil, fmt.Errorf("structured append parity %#02x does not match data parity %#02x", header.Parity, parity)
+	}
+	if err := joined.transcodeUndetected(); err != nil {
+		return nil, err
+	}
+	return joined, nil
+}
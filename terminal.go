@@ -0,0 +1,198 @@
+package qrcode
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Half-block characters draw two module rows in one line of text.
+const (
+	blockFull  = '█'
+	blockUpper = '▀'
+	blockLower = '▄'
+)
+
+const (
+	ansiDarkOnLight = "\x1b[30;47m"
+	ansiLightOnDark = "\x1b[37;40m"
+	ansiReset       = "\x1b[0m"
+)
+
+// TerminalOptions control how WriteTerminal prints a Matrix.
+type TerminalOptions struct {
+	// QuietZone is the width of the light margin around the symbol in
+	// modules.
+	QuietZone int
+
+	// Invert draws the light modules instead of the dark ones, for
+	// terminals with light text on a dark background.
+	Invert bool
+
+	// Color sets the colours with ANSI escape codes, black on white or
+	// white on black when inverted, so the symbol does not depend on the
+	// colours of the terminal.
+	Color bool
+}
+
+// DefaultTerminalOptions are used when no options are given.
+var DefaultTerminalOptions = TerminalOptions{
+	QuietZone: 2,
+}
+
+// WriteTerminal prints the symbol with Unicode half-block characters, two
+// module rows per line.
+func (mx *Matrix) WriteTerminal(w io.Writer, opts *TerminalOptions) error {
+	if opts == nil {
+		opts = &DefaultTerminalOptions
+	}
+	quiet := max(opts.QuietZone, 0)
+	columns, rows := mx.gridSize()
+	width, height := columns+2*quiet, rows+2*quiet
+	drawn := func(x, y int) bool {
+		return mx.AtPoints(x-quiet, y-quiet) != opts.Invert
+	}
+
+	bw := bufio.NewWriter(w)
+	for y := 0; y < height; y += 2 {
+		if opts.Color {
+			if opts.Invert {
+				bw.WriteString(ansiLightOnDark)
+			} else {
+				bw.WriteString(ansiDarkOnLight)
+			}
+		}
+		for x := 0; x < width; x++ {
+			// The row under the last one of an odd height is quiet zone.
+			top, bottom := drawn(x, y), drawn(x, y+1)
+			switch {
+			case top && bottom:
+				bw.WriteRune(blockFull)
+			case top:
+				bw.WriteRune(blockUpper)
+			case bottom:
+				bw.WriteRune(blockLower)
+			default:
+				bw.WriteByte(' ')
+			}
+		}
+		if opts.Color {
+			bw.WriteString(ansiReset)
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*[A-Za-z]")
+
+// ParseTerminal reads a symbol printed by WriteTerminal or written by hand.
+// Text with half-block characters holds two module rows per line; otherwise
+// every line is one row, with '█', '#' and 'X' for drawn modules and any
+// other character for blank ones. Drawn modules are dark, or light when
+// invert is set. ANSI escape codes are ignored and the quiet zone is cut off
+// at the outermost dark modules, or one module further when the last column
+// or row has no dark module left and the light one completes the size of a
+// symbol.
+func ParseTerminal(text string, invert bool) (*Matrix, error) {
+	text = ansiEscape.ReplaceAllString(text, "")
+	halfBlocks := strings.ContainsAny(text, string([]rune{blockUpper, blockLower}))
+
+	var rows [][]bool
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		var top, bottom []bool
+		for _, r := range strings.TrimRight(line, "\r") {
+			if halfBlocks {
+				top = append(top, r == blockFull || r == blockUpper)
+				bottom = append(bottom, r == blockFull || r == blockLower)
+			} else {
+				top = append(top, r == blockFull || r == '#' || r == 'X')
+			}
+		}
+		rows = append(rows, top)
+		if halfBlocks {
+			rows = append(rows, bottom)
+		}
+	}
+
+	// The dark modules span the symbol; cells missing at the end of a
+	// line are blank.
+	dark := func(x, y int) bool {
+		return (x < len(rows[y]) && rows[y][x]) != invert
+	}
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+	minX, minY, maxX, maxY := width, len(rows), -1, -1
+	for y := range rows {
+		for x := 0; x < width; x++ {
+			if dark(x, y) {
+				minX, minY = min(minX, x), min(minY, y)
+				maxX, maxY = max(maxX, x), max(maxY, y)
+			}
+		}
+	}
+	if maxX < 0 {
+		return nil, errors.New("no dark modules found")
+	}
+
+	// A damaged timing pattern can leave the last column or row of a Micro
+	// QR or rMQR symbol without dark modules.
+	symbolWidth, symbolHeight := maxX-minX+1, maxY-minY+1
+	for _, size := range [][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+		if isSymbolSize(symbolWidth+size[0], symbolHeight+size[1]) {
+			symbolWidth, symbolHeight = symbolWidth+size[0], symbolHeight+size[1]
+			break
+		}
+	}
+
+	mx := new(Matrix)
+	for y := minY; y < minY+symbolHeight; y++ {
+		line := make([]bool, symbolWidth)
+		for x := range line {
+			line[x] = minX+x < width && y < len(rows) && dark(minX+x, y)
+		}
+		mx.Points = append(mx.Points, line)
+	}
+	return mx, nil
+}
+
+// isSymbolSize reports whether width by height modules is the size of a QR,
+// Micro QR or rMQR symbol.
+func isSymbolSize(width, height int) bool {
+	if width == height {
+		return isMicroWidth(width) || width >= 21 && width <= 177 && (width-17)%4 == 0
+	}
+	return rmqrVersionOfSize(height, width) != nil
+}
+
+// DecodeTerminal decodes a symbol read by ParseTerminal, for example a test
+// fixture written as text.
+func DecodeTerminal(text string, invert bool) (*Matrix, error) {
+	return new(Decoder).DecodeTerminal(text, invert)
+}
+
+// DecodeTerminal decodes a symbol read by ParseTerminal like the package level
+// DecodeTerminal.
+func (d *Decoder) DecodeTerminal(text string, invert bool) (*Matrix, error) {
+	mx, err := ParseTerminal(text, invert)
+	if err != nil {
+		return nil, err
+	}
+	check := mx.CheckSize
+	if mx.IsMicro() {
+		check = mx.checkMicroSize
+	} else if mx.IsRMQR() {
+		check = mx.checkRMQRSize
+	}
+	if err := check(); err != nil {
+		return nil, err
+	}
+	if err := d.decodeMatrix(mx); err != nil {
+		return nil, err
+	}
+	return mx, nil
+}
@@ -0,0 +1,249 @@
+package qrcode
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// VectorOptions control the SVG and PDF output of a Matrix.
+type VectorOptions struct {
+	// ModuleSize is the width of a module in millimetres, 0.5 if not set.
+	ModuleSize float64
+
+	// QuietZone is the width of the light margin around the symbol in
+	// modules. ISO/IEC 18004 asks for 4.
+	QuietZone int
+
+	// Foreground is the colour of dark modules, black if nil, and Background
+	// the colour of the light area, white if nil. A transparent background
+	// is left out.
+	Foreground color.Color
+	Background color.Color
+
+	// Text is printed centred under the symbol in a monospace font of
+	// FontSize millimetres, 3 if not set.
+	Text     string
+	FontSize float64
+}
+
+// DefaultVectorOptions are used when no options are given.
+var DefaultVectorOptions = VectorOptions{
+	ModuleSize: 0.5,
+	QuietZone:  4,
+}
+
+func (opts *VectorOptions) withDefaults() VectorOptions {
+	if opts == nil {
+		opts = &DefaultVectorOptions
+	}
+	o := *opts
+	if o.ModuleSize <= 0 {
+		o.ModuleSize = DefaultVectorOptions.ModuleSize
+	}
+	o.QuietZone = max(o.QuietZone, 0)
+	if o.Foreground == nil {
+		o.Foreground = color.Black
+	}
+	if o.Background == nil {
+		o.Background = color.White
+	}
+	if o.FontSize <= 0 {
+		o.FontSize = 3
+	}
+	return o
+}
+
+// size returns the width of the artwork, the height of the symbol with its
+// quiet zone and the height of the artwork with the text, in modules.
+func (o *VectorOptions) size(mx *Matrix) (float64, float64, float64) {
+	columns, rows := mx.gridSize()
+	width := float64(columns + 2*o.QuietZone)
+	symbol := float64(rows + 2*o.QuietZone)
+	height := symbol
+	if o.Text != "" {
+		height += o.textLine()
+	}
+	return width, symbol, height
+}
+
+// textLine returns the height of the line of text in modules.
+func (o *VectorOptions) textLine() float64 {
+	return o.FontSize * 1.5 / o.ModuleSize
+}
+
+// moduleRects merges the dark modules into rectangles: runs of a row, each
+// extended down over the rows that have the same run.
+func (mx *Matrix) moduleRects() []image.Rectangle {
+	var rects []image.Rectangle
+	used := make(map[image.Point]bool)
+	width, height := mx.gridSize()
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if !mx.AtPoints(x, y) || used[image.Pt(x, y)] {
+				continue
+			}
+			end := x
+			for end < width && mx.AtPoints(end, y) && !used[image.Pt(end, y)] {
+				end++
+			}
+			bottom := y + 1
+			for ; bottom < height; bottom++ {
+				if !mx.isRun(x, end, bottom) {
+					break
+				}
+			}
+			for ry := y; ry < bottom; ry++ {
+				for rx := x; rx < end; rx++ {
+					used[image.Pt(rx, ry)] = true
+				}
+			}
+			rects = append(rects, image.Rect(x, y, end, bottom))
+			x = end
+		}
+	}
+	return rects
+}
+
+// isRun reports whether the modules from x to end of row y are a whole run of
+// dark modules.
+func (mx *Matrix) isRun(x, end, y int) bool {
+	if mx.AtPoints(x-1, y) || mx.AtPoints(end, y) {
+		return false
+	}
+	for ; x < end; x++ {
+		if !mx.AtPoints(x, y) {
+			return false
+		}
+	}
+	return true
+}
+
+func hexColor(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
+
+func transparent(c color.Color) bool {
+	_, _, _, a := c.RGBA()
+	return a == 0
+}
+
+// WriteSVG writes the symbol as SVG with all dark modules in one path, in
+// module units scaled to the physical size.
+func (mx *Matrix) WriteSVG(w io.Writer, opts *VectorOptions) error {
+	o := opts.withDefaults()
+	width, symbol, height := o.size(mx)
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="%smm" height="%smm" viewBox="0 0 %s %s" shape-rendering="crispEdges">`+"\n",
+		formatFloat(width*o.ModuleSize), formatFloat(height*o.ModuleSize), formatFloat(width), formatFloat(height))
+	if !transparent(o.Background) {
+		fmt.Fprintf(bw, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", hexColor(o.Background))
+	}
+	bw.WriteString(`<path d="`)
+	for _, r := range mx.moduleRects() {
+		fmt.Fprintf(bw, "M%d %dh%dv%dh-%dz", r.Min.X+o.QuietZone, r.Min.Y+o.QuietZone, r.Dx(), r.Dy(), r.Dx())
+	}
+	fmt.Fprintf(bw, `" fill="%s"/>`+"\n", hexColor(o.Foreground))
+	if o.Text != "" {
+		var text bytes.Buffer
+		if err := xml.EscapeText(&text, []byte(o.Text)); err != nil {
+			return err
+		}
+		fmt.Fprintf(bw, `<text x="%s" y="%s" font-family="monospace" font-size="%s" text-anchor="middle" fill="%s">%s</text>`+"\n",
+			formatFloat(width/2), formatFloat(symbol+o.FontSize/o.ModuleSize), formatFloat(o.FontSize/o.ModuleSize), hexColor(o.Foreground), text.String())
+	}
+	bw.WriteString("</svg>\n")
+	return bw.Flush()
+}
+
+// WritePDF writes the symbol as a single page PDF of the size of the
+// artwork. The text is set in Courier; characters outside of Latin-1 are
+// printed as question marks.
+func (mx *Matrix) WritePDF(w io.Writer, opts *VectorOptions) error {
+	o := opts.withDefaults()
+	width, symbol, height := o.size(mx)
+	// PDF measures in points from the bottom left corner.
+	unit := o.ModuleSize * 72 / 25.4
+	pt := func(v float64) string { return formatFloat(v * unit) }
+
+	var content bytes.Buffer
+	if !transparent(o.Background) {
+		fmt.Fprintf(&content, "%s rg 0 0 %s %s re f\n", pdfColor(o.Background), pt(width), pt(height))
+	}
+	fmt.Fprintf(&content, "%s rg\n", pdfColor(o.Foreground))
+	for _, r := range mx.moduleRects() {
+		fmt.Fprintf(&content, "%s %s %s %s re\n",
+			pt(float64(r.Min.X+o.QuietZone)), pt(height-float64(r.Max.Y+o.QuietZone)), pt(float64(r.Dx())), pt(float64(r.Dy())))
+	}
+	content.WriteString("f\n")
+	var font string
+	if o.Text != "" {
+		text := pdfString(o.Text)
+		fontSize := o.FontSize / o.ModuleSize
+		// Courier is 0.6 em wide.
+		x := width/2 - float64(utf8.RuneCountInString(o.Text))*0.6*fontSize/2
+		fmt.Fprintf(&content, "BT /F1 %s Tf %s %s Td %s Tj ET\n", pt(fontSize), pt(x), pt(height-symbol-fontSize), text)
+		font = " /Resources << /Font << /F1 5 0 R >> >>"
+	}
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Contents 4 0 R%s >>", pt(width), pt(height), font),
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+	}
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = pdf.Len()
+		fmt.Fprintf(&pdf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := pdf.Len()
+	fmt.Fprintf(&pdf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&pdf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&pdf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	_, err := w.Write(pdf.Bytes())
+	return err
+}
+
+func pdfColor(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("%s %s %s", formatFloat(float64(r)/0xffff), formatFloat(float64(g)/0xffff), formatFloat(float64(b)/0xffff))
+}
+
+// pdfString quotes text as a PDF string of Latin-1 characters.
+func pdfString(text string) string {
+	var b bytes.Buffer
+	b.WriteByte('(')
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < ' ' || r > 0xff:
+			b.WriteByte('?')
+		default:
+			b.WriteByte(byte(r))
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// formatFloat formats a coordinate to a thousandth.
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1000)/1000, 'f', -1, 64)
+}
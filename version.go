@@ -3,7 +3,9 @@ package qrcode
 import (
 	"errors"
 	"fmt"
-	"strings"
+
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
 )
 
 // Error detection/recovery capacity.
@@ -19,6 +21,10 @@ const (
 	dataEncoderType1To9 dataEncoderType = iota
 	dataEncoderType10To26
 	dataEncoderType27To40
+	dataEncoderTypeM1
+	dataEncoderTypeM2
+	dataEncoderTypeM3
+	dataEncoderTypeM4
 )
 
 const (
@@ -2831,6 +2837,116 @@ var (
 			0,
 		},
 	}
+
+	// MicroVersions lists the Micro QR symbols M1 to M4 in the order of their
+	// symbol numbers in the format information. M1 only detects errors and
+	// is listed as Low. The last data codeword of M1 and M3 has 4 bits.
+	MicroVersions = []QRcodeVersion{
+		{
+			1,
+			Low,
+			dataEncoderTypeM1,
+			[]Block{
+				{
+					1,
+					5,
+					3,
+				},
+			},
+			0,
+		},
+		{
+			2,
+			Low,
+			dataEncoderTypeM2,
+			[]Block{
+				{
+					1,
+					10,
+					5,
+				},
+			},
+			0,
+		},
+		{
+			2,
+			Medium,
+			dataEncoderTypeM2,
+			[]Block{
+				{
+					1,
+					10,
+					4,
+				},
+			},
+			0,
+		},
+		{
+			3,
+			Low,
+			dataEncoderTypeM3,
+			[]Block{
+				{
+					1,
+					17,
+					11,
+				},
+			},
+			0,
+		},
+		{
+			3,
+			Medium,
+			dataEncoderTypeM3,
+			[]Block{
+				{
+					1,
+					17,
+					9,
+				},
+			},
+			0,
+		},
+		{
+			4,
+			Low,
+			dataEncoderTypeM4,
+			[]Block{
+				{
+					1,
+					24,
+					16,
+				},
+			},
+			0,
+		},
+		{
+			4,
+			Medium,
+			dataEncoderTypeM4,
+			[]Block{
+				{
+					1,
+					24,
+					14,
+				},
+			},
+			0,
+		},
+		{
+			4,
+			High,
+			dataEncoderTypeM4,
+			[]Block{
+				{
+					1,
+					24,
+					10,
+				},
+			},
+			0,
+		},
+	}
 )
 
 // A dataEncoder encodes data for a particular QR Code Version.
@@ -2843,6 +2959,11 @@ type dataEncoder struct {
 	numNumericCharCountBits      int
 	numAlphanumericCharCountBits int
 	numByteCharCountBits         int
+	numKanjiCharCountBits        int
+
+	// strictAlphanumeric is handed to the AlphanumericDecoder of the
+	// alphanumeric segments.
+	strictAlphanumeric bool
 	ModeCharDecoder
 }
 
@@ -2853,6 +2974,7 @@ var dataEncoderTypeMap = map[dataEncoderType]*dataEncoder{
 		numNumericCharCountBits:      10,
 		numAlphanumericCharCountBits: 9,
 		numByteCharCountBits:         8,
+		numKanjiCharCountBits:        8,
 	},
 	dataEncoderType10To26: {
 		minVersion:                   10,
@@ -2860,6 +2982,7 @@ var dataEncoderTypeMap = map[dataEncoderType]*dataEncoder{
 		numNumericCharCountBits:      12,
 		numAlphanumericCharCountBits: 11,
 		numByteCharCountBits:         16,
+		numKanjiCharCountBits:        10,
 	},
 	dataEncoderType27To40: {
 		minVersion:                   27,
@@ -2867,89 +2990,307 @@ var dataEncoderTypeMap = map[dataEncoderType]*dataEncoder{
 		numNumericCharCountBits:      14,
 		numAlphanumericCharCountBits: 13,
 		numByteCharCountBits:         16,
+		numKanjiCharCountBits:        12,
+	},
+	dataEncoderTypeM1: {
+		minVersion:              1,
+		maxVersion:              1,
+		numNumericCharCountBits: 3,
+	},
+	dataEncoderTypeM2: {
+		minVersion:                   2,
+		maxVersion:                   2,
+		numNumericCharCountBits:      4,
+		numAlphanumericCharCountBits: 3,
+	},
+	dataEncoderTypeM3: {
+		minVersion:                   3,
+		maxVersion:                   3,
+		numNumericCharCountBits:      5,
+		numAlphanumericCharCountBits: 4,
+		numByteCharCountBits:         4,
+		numKanjiCharCountBits:        3,
+	},
+	dataEncoderTypeM4: {
+		minVersion:                   4,
+		maxVersion:                   4,
+		numNumericCharCountBits:      6,
+		numAlphanumericCharCountBits: 5,
+		numByteCharCountBits:         5,
+		numKanjiCharCountBits:        4,
 	},
 }
 
+// GetDataEncoder returns a copy of the dataEncoder of version, so that
+// selecting a ModeCharDecoder never races with other decodes.
 func GetDataEncoder(version int) (*dataEncoder, error) {
+	var encoder dataEncoder
 	switch {
 	case version >= 1 && version <= 9:
-		return dataEncoderTypeMap[dataEncoderType1To9], nil
+		encoder = *dataEncoderTypeMap[dataEncoderType1To9]
 	case version >= 10 && version <= 26:
-		return dataEncoderTypeMap[dataEncoderType10To26], nil
+		encoder = *dataEncoderTypeMap[dataEncoderType10To26]
 	case version >= 27 && version <= 40:
-		return dataEncoderTypeMap[dataEncoderType27To40], nil
+		encoder = *dataEncoderTypeMap[dataEncoderType27To40]
 	default:
 		return nil, errors.New("version not found")
 	}
+	return &encoder, nil
 }
 
 func (de *dataEncoder) SetCharModeCharDecoder(mode int) error {
 	switch mode {
-	case 2:
-		de.ModeCharDecoder = &AlphanumericDecoder{countIndicator: de.numAlphanumericCharCountBits}
+	case ModeNumeric:
+		de.ModeCharDecoder = &NumericDecoder{countIndicator: de.numNumericCharCountBits}
+		return nil
+	case ModeAlphanumeric:
+		de.ModeCharDecoder = &AlphanumericDecoder{countIndicator: de.numAlphanumericCharCountBits, Strict: de.strictAlphanumeric}
 		return nil
-	case 4:
+	case ModeByte:
 		de.ModeCharDecoder = &EightBitDecoder{countIndicator: de.numByteCharCountBits}
 		return nil
+	case ModeKanji:
+		de.ModeCharDecoder = &KanjiDecoder{countIndicator: de.numKanjiCharCountBits}
+		return nil
+	case ModeHanzi:
+		de.ModeCharDecoder = &HanziDecoder{countIndicator: de.numKanjiCharCountBits}
+		return nil
 	}
 	return fmt.Errorf("mode:%v not suport", mode)
 }
 
-var AlphanumericDecoderChar = []string{
-	"0", "1", "2", "3", "4", "5", "6", "7", "8", "9",
-	"A", "B", "C", "D", "E", "F", "G", "H", "I", "J",
-	"K", "L", "M", "N", "O", "P", "Q", "R", "S", "T",
-	"U", "V", "W", "X", "Y", "Z", "SP", "$", "%", "*",
-	"+", "-", ".", "/", ":"}
+// countBits returns the length of the character count indicator of mode.
+// Hanzi mode uses the lengths of Kanji mode.
+func (de *dataEncoder) countBits(mode int) int {
+	switch mode {
+	case ModeNumeric:
+		return de.numNumericCharCountBits
+	case ModeAlphanumeric:
+		return de.numAlphanumericCharCountBits
+	case ModeByte:
+		return de.numByteCharCountBits
+	case ModeKanji, ModeHanzi:
+		return de.numKanjiCharCountBits
+	}
+	return 0
+}
 
+// charCount reads the character count indicator of a segment of mode from
+// the bits that follow its mode indicator.
+func (de *dataEncoder) charCount(mode int, data []bool) int {
+	offset := 0
+	if mode == ModeHanzi {
+		// The count follows the subset indicator.
+		offset = hanziSubsetBits
+	}
+	length := de.countBits(mode)
+	if offset+length > len(data) {
+		return 0
+	}
+	return Bit2Int(data[offset : offset+length])
+}
+
+// alphanumericChars are the 45 characters of alphanumeric mode in the order
+// of their values.
+const alphanumericChars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+// ModeCharDecoder decodes a single segment. The bits passed to Decode start
+// at the character count indicator, right after the mode indicator, and may
+// continue with further segments. Decode returns how many bits the segment
+// declares, count indicator included, so that decoding can carry on behind
+// it; used exceeds len(b) when the segment is truncated.
 type ModeCharDecoder interface {
-	Decode(b []bool) ([]byte, error)
+	Decode(b []bool) (result []byte, used int, err error)
 }
 
-type AlphanumericDecoder struct {
+// NumericDecoder decodes numeric mode: groups of three digits in 10 bits,
+// with a final group of two digits in 7 bits or one digit in 4 bits.
+type NumericDecoder struct {
 	countIndicator int
 }
 
-func (d *AlphanumericDecoder) Decode(data []bool) ([]byte, error) {
-	encodeLength := 11
-	dataLenght := Bit2Int(data[0:d.countIndicator])
-	hpos := dataLenght/2*encodeLength + (encodeLength - dataLenght%2)
+func (d *NumericDecoder) Decode(data []bool) ([]byte, int, error) {
+	if len(data) < d.countIndicator {
+		return nil, 0, errors.New("numeric data too short for character count")
+	}
+	dataLength := Bit2Int(data[0:d.countIndicator])
+	used := d.countIndicator + dataLength/3*10 + []int{0, 4, 7}[dataLength%3]
 
-	data = data[d.countIndicator:hpos]
-	result := strings.Builder{}
-	for i := 0; i < dataLenght*encodeLength && i < len(data); i = i + encodeLength {
-		ipos := i + encodeLength
-		if ipos > len(data)-1 && Bit2Int(data[i:]) < 45 {
-			result.WriteString(AlphanumericDecoderChar[Bit2Int(data[i:ipos])])
-		} else {
-			first := Bit2Int(data[i:ipos]) / 45
-			result.WriteString(AlphanumericDecoderChar[first])
-			second := Bit2Int(data[i:ipos]) - first*45
-			if second < 45 {
-				result.WriteString(AlphanumericDecoderChar[second])
-			}
+	var result []byte
+	for pos, left := d.countIndicator, dataLength; left > 0; {
+		digits, width := 3, 10
+		switch left {
+		case 2:
+			digits, width = 2, 7
+		case 1:
+			digits, width = 1, 4
+		}
+		if pos+width > len(data) {
+			break
+		}
+		value := Bit2Int(data[pos : pos+width])
+		if value >= []int{1, 10, 100, 1000}[digits] {
+			return nil, 0, fmt.Errorf("invalid numeric group %d for %d digits", value, digits)
+		}
+		result = append(result, fmt.Sprintf("%0*d", digits, value)...)
+		pos += width
+		left -= digits
+	}
+	return result, used, nil
+}
 
+// AlphanumericDecoder decodes alphanumeric mode (ISO/IEC 18004 7.4.4): pairs
+// of characters in 11 bits as 45 × first + second, with a final single
+// character in 6 bits.
+type AlphanumericDecoder struct {
+	countIndicator int
+
+	// Strict makes Decode fail when the data is shorter than the character
+	// count declares, instead of decoding the characters that are complete.
+	Strict bool
+}
+
+func (d *AlphanumericDecoder) Decode(data []bool) ([]byte, int, error) {
+	if len(data) < d.countIndicator {
+		return nil, 0, errors.New("alphanumeric data too short for character count")
+	}
+	dataLength := Bit2Int(data[0:d.countIndicator])
+	used := d.countIndicator + dataLength/2*11 + dataLength%2*6
+	if d.Strict && used > len(data) {
+		return nil, 0, fmt.Errorf("alphanumeric segment of %d characters needs %d bits, got %d", dataLength, used, len(data))
+	}
+
+	result := make([]byte, 0, dataLength)
+	pos := d.countIndicator
+	for i := 0; i+1 < dataLength && pos+11 <= len(data); i += 2 {
+		value := Bit2Int(data[pos : pos+11])
+		if value >= 45*45 {
+			return nil, 0, fmt.Errorf("invalid alphanumeric value %d", value)
+		}
+		result = append(result, alphanumericChars[value/45], alphanumericChars[value%45])
+		pos += 11
+	}
+	if dataLength%2 == 1 && len(result) == dataLength-1 && pos+6 <= len(data) {
+		value := Bit2Int(data[pos : pos+6])
+		if value >= 45 {
+			return nil, 0, fmt.Errorf("invalid alphanumeric value %d", value)
 		}
+		result = append(result, alphanumericChars[value])
 	}
-	return []byte(result.String()), nil
+	return result, used, nil
 }
 
 type EightBitDecoder struct {
 	countIndicator int
 }
 
-func (d *EightBitDecoder) Decode(data []bool) ([]byte, error) {
+func (d *EightBitDecoder) Decode(data []bool) ([]byte, int, error) {
+	if len(data) < d.countIndicator {
+		return nil, 0, errors.New("byte data too short for character count")
+	}
 	dataLength := Bit2Int(data[0:d.countIndicator])
 	hpos := dataLength*8 + d.countIndicator
+	used := hpos
 	size := len(data)
-	if hpos > size-1 {
-		hpos = size - 1
+	if hpos > size {
+		hpos = size
 	}
 	var result []byte
 	data = data[d.countIndicator:hpos]
 
-	for i := 0; i < dataLength*8 && i < size; i += 8 {
+	for i := 0; i < dataLength*8 && i+8 <= len(data); i += 8 {
 		result = append(result, Bit2Byte(data[i:i+8]))
 	}
-	return result, nil
+	return result, used, nil
+}
+
+// KanjiDecoder decodes Kanji mode. Every character is a Shift JIS double-byte
+// code compacted into 13 bits; the result is converted to UTF-8.
+type KanjiDecoder struct {
+	countIndicator int
+}
+
+func (d *KanjiDecoder) Decode(data []bool) ([]byte, int, error) {
+	sjis, used, err := d.DecodeShiftJIS(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	result, err := japanese.ShiftJIS.NewDecoder().Bytes(sjis)
+	if err != nil {
+		return nil, 0, err
+	}
+	return result, used, nil
+}
+
+// DecodeShiftJIS decodes a Kanji segment to the Shift JIS bytes it encodes.
+func (d *KanjiDecoder) DecodeShiftJIS(data []bool) ([]byte, int, error) {
+	if len(data) < d.countIndicator {
+		return nil, 0, errors.New("kanji data too short for character count")
+	}
+	dataLength := Bit2Int(data[0:d.countIndicator])
+	used := d.countIndicator + dataLength*13
+
+	var sjis []byte
+	for pos := d.countIndicator; pos < used && pos+13 <= len(data); pos += 13 {
+		value := Bit2Int(data[pos : pos+13])
+		code := value/0xc0<<8 | value%0xc0
+		if code < 0x1f00 {
+			code += 0x8140
+		} else {
+			code += 0xc140
+		}
+		sjis = append(sjis, byte(code>>8), byte(code))
+	}
+	return sjis, used, nil
+}
+
+// hanziSubsetBits is the length of the subset indicator of a Hanzi segment.
+const hanziSubsetBits = 4
+
+// hanziSubsetGB2312 is the subset indicator of GB2312 characters.
+const hanziSubsetGB2312 = 1
+
+// HanziDecoder decodes Hanzi mode of GB/T 18284: a 4-bit subset indicator,
+// then the character count and GB2312 characters compacted to 13 bits each.
+// The character count indicator is as long as in Kanji mode.
+type HanziDecoder struct {
+	countIndicator int
+}
+
+func (d *HanziDecoder) Decode(data []bool) ([]byte, int, error) {
+	gb, used, err := d.DecodeGB2312(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	result, err := simplifiedchinese.GBK.NewDecoder().Bytes(gb)
+	if err != nil {
+		return nil, 0, err
+	}
+	return result, used, nil
+}
+
+// DecodeGB2312 decodes a Hanzi segment to the GB2312 bytes it encodes.
+func (d *HanziDecoder) DecodeGB2312(data []bool) ([]byte, int, error) {
+	if len(data) < hanziSubsetBits+d.countIndicator {
+		return nil, 0, errors.New("hanzi data too short for character count")
+	}
+	if subset := Bit2Int(data[0:hanziSubsetBits]); subset != hanziSubsetGB2312 {
+		return nil, 0, fmt.Errorf("hanzi subset %d not supported", subset)
+	}
+	start := hanziSubsetBits + d.countIndicator
+	dataLength := Bit2Int(data[hanziSubsetBits:start])
+	used := start + dataLength*13
+
+	var gb []byte
+	for pos := start; pos < used && pos+13 <= len(data); pos += 13 {
+		value := Bit2Int(data[pos : pos+13])
+		code := value/0x60<<8 | value%0x60
+		if code < 0xa00 {
+			code += 0xa1a1
+		} else {
+			code += 0xa6a1
+		}
+		gb = append(gb, byte(code>>8), byte(code))
+	}
+	return gb, used, nil
 }